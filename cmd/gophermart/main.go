@@ -2,18 +2,36 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"gophermart/internal/api"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"sync"
 	"syscall"
 	"time"
 
 	conf "gophermart/internal/config"
+	"gophermart/internal/events"
+	"gophermart/internal/guard"
+	"gophermart/internal/health"
+	"gophermart/internal/logging"
+	"gophermart/internal/metrics"
+	"gophermart/internal/model"
+	"gophermart/internal/outbox"
+	"gophermart/internal/policy"
 	"gophermart/internal/polling"
 	"gophermart/internal/store"
+	"gophermart/internal/tlscert"
+	"gophermart/internal/tracing"
+	"gophermart/internal/webhook"
+
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var lvl *slog.LevelVar
@@ -21,71 +39,367 @@ var lvl *slog.LevelVar
 func init() {
 	lvl = new(slog.LevelVar)
 	lvl.Set(slog.LevelInfo)
-	Log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: lvl}))
+	Log := slog.New(logging.NewHandler(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: lvl})))
 	slog.SetDefault(Log)
 }
 
-func setLogLevel(level string) {
-	var lvlVal slog.Level
-	switch level {
-	case "debug":
-		lvlVal = slog.LevelDebug
-	case "info":
-		lvlVal = slog.LevelInfo
-	case "error":
-		lvlVal = slog.LevelError
-	default:
-		lvlVal = slog.LevelDebug
+// setupLogger replaces default logger with configured format and redaction, they are validated by config
+func setupLogger(cfg conf.Config) {
+	level, _ := logging.ParseLevel(cfg.Level)
+	lvl.Set(level)
+	redactor, _ := cfg.Redactor()
+	logging.SetRedactor(redactor)
+	logging.SetPIIKey([]byte(cfg.LogPIIKey))
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redactor.ReplaceAttr}
+	var h slog.Handler = slog.NewTextHandler(os.Stdout, opts)
+	if cfg.LogFormat == "json" {
+		h = slog.NewJSONHandler(os.Stdout, opts)
+	}
+	slog.SetDefault(slog.New(logging.NewHandler(h)))
+	slog.Info("logger configured", slog.String("level", logging.LevelName(level)), slog.String("format", cfg.LogFormat))
+}
+
+// toggleDebug switches between debug and configured level on SIGUSR1
+func toggleDebug(configured string) {
+	level, _ := logging.ParseLevel(configured)
+	if lvl.Level() != slog.LevelDebug {
+		level = slog.LevelDebug
 	}
-	slog.Info(fmt.Sprintf("log level %s", lvlVal))
-	lvl.Set(lvlVal)
+	lvl.Set(level)
+	slog.Info("log level changed by SIGUSR1", slog.String("level", logging.LevelName(level)))
 }
 
 func mainWithError(cfg conf.Config) error {
-	st, err := store.NewStore(context.Background(), cfg.DatabaseURI)
+	shutdownTracing, err := tracing.Setup(cfg.TracingExporter, cfg.TracingFile, cfg.TracingSampleRatio)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error(fmt.Sprintf("flush traces: %s", err))
+		}
+	}()
+	st, err := store.NewStore(context.Background(), cfg.DatabaseURI, store.WithMaxConns(cfg.DBMaxConns))
 	if err != nil {
 		err = fmt.Errorf("unable to create connection pool: %w", err)
 		return err
 	}
+	// пул закрывается последним, после остановки опросов
 	defer st.Close()
+	revoked, err := st.RevokeAdmins(context.Background(), cfg.AdminLogins)
+	if err != nil {
+		return fmt.Errorf("unable to revoke admin roles: %w", err)
+	}
+	if revoked > 0 {
+		slog.Info("admin role revoked from users not listed in admin_logins", slog.Int64("users", revoked))
+	}
+	for _, login := range cfg.AdminLogins {
+		if err := st.SetRole(context.Background(), login, model.RoleAdmin); err != nil {
+			slog.Warn(fmt.Sprintf("unable to grant admin role: %s", err), slog.Any("login", logging.PII(login)))
+		}
+	}
 	slog.Info("accrual system info", slog.String("accrual_url", cfg.AccrualSystemAddress))
-	pollster := polling.NewPollster(cfg.AccrualSystemAddress, st)
+	pollster := polling.NewPollster(cfg.AccrualSystemAddress, st,
+		polling.WithConcurrency(cfg.PollConcurrency),
+		polling.WithRateLimit(cfg.AccrualRateLimit),
+		polling.WithClaimer(st),
+	)
 
 	go pollster.Run(context.Background(), time.Duration(cfg.PollInterval)*time.Second)
-	defer pollster.Stop()
+	// очередь опроса не сохраняется, она восстанавливается по заказам без окончательного статуса;
+	// каждый заказ опрашивает одна реплика, взявшая его в аренду
+	if queued, err := st.ListUnfinishedOrders(context.Background()); err != nil {
+		slog.Error(fmt.Sprintf("unable to resume polling queue: %s", err))
+	} else if len(queued) > 0 {
+		pollster.Resume(queued)
+		slog.Info("polling queue resumed", slog.Int("orders", len(queued)))
+	}
 
-	handler := api.NewHandler(st, pollster)
-	router := api.Router(handler)
-	server := &http.Server{
-		Addr:    cfg.RunAddress,
-		Handler: router,
+	loginGuard := guard.New(st, guardPolicy(cfg))
+	credsPolicy, err := policy.New(
+		cfg.LoginMinLen,
+		cfg.LoginMaxLen,
+		cfg.LoginCharset,
+		cfg.PasswordMinLen,
+		cfg.PasswordMaxLen,
+		cfg.RejectCommonPasswords,
+	)
+	if err != nil {
+		return err
+	}
+	// фоновые задачи, использующие пул; при остановке они завершаются до его закрытия
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
+	runWorker := func(run func()) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run()
+		}()
 	}
-	errCh := make(chan error)
 
-	go func() {
-		errCh <- server.ListenAndServe()
-	}()
-	slog.Info(fmt.Sprintf("service listening on %s", cfg.RunAddress))
+	broker := events.NewBroker()
+	switch cfg.EventsMode {
+	case "local":
+		st.OnUserEvent(broker.Publish)
+	case "postgres":
+		runWorker(func() { st.ListenUserEvents(workersCtx, broker.Publish) })
+	default:
+		return fmt.Errorf("unknown events mode %q", cfg.EventsMode)
+	}
+
+	pruner := events.NewPruner(st, cfg.EventsRetention, 1000)
+	runWorker(func() { pruner.Run(workersCtx, cfg.EventsPruneInterval) })
+
+	dispatcher := webhook.NewDispatcher(st, webhook.Policy{
+		MaxAttempts: cfg.WebhookMaxAttempts,
+		BaseDelay:   cfg.WebhookBaseDelay,
+		MaxDelay:    cfg.WebhookMaxDelay,
+		Timeout:     cfg.WebhookTimeout,
+		BatchSize:   100,
+	})
+	runWorker(func() { dispatcher.Run(workersCtx, cfg.WebhookInterval) })
+
+	// outbox - единственный источник событий: релей создаёт доставки вебхуков
+	// и, если настроено, публикует сообщения внешним потребителям
+	publishers := outbox.MultiPublisher{webhook.NewFanout(st)}
+	publisher, err := newOutboxPublisher(cfg)
+	if err != nil {
+		return err
+	}
+	if publisher != nil {
+		publishers = append(publishers, publisher)
+	}
+	relay := outbox.NewRelay(st, publishers, 100)
+	runWorker(func() { relay.Run(workersCtx, cfg.OutboxInterval) })
+
+	cors := api.NewCORS(cfg.CORSOrigins)
+	proxies, _ := cfg.ProxyPrefixes()
+	opts := []api.HandlerOption{
+		api.WithLoginGuard(loginGuard),
+		api.WithCredsPolicy(credsPolicy),
+		api.WithBatchLimit(cfg.OrdersBatchMax),
+		api.WithEvents(broker),
+		api.WithLogLevel(lvl),
+		api.WithCORS(cors),
+		api.WithTrustedProxies(proxies),
+	}
+	if cfg.Mode != "prod" {
+		opts = append(opts, api.WithSpecValidation(cfg.Mode == "test"))
+	}
+	registerMetrics(st, pollster)
+	checker := health.New(cfg.HealthCheckTimeout)
+	checker.Add("postgres", st.Ping)
+	checker.Add("migrations", st.CheckSchema)
+	checker.Add("pollster", pollster.CheckRunning)
+	checker.AddDegraded("accrual", pollster.CheckAccrual)
+	opts = append(opts, api.WithHealth(checker))
+	var adminServer *http.Server
+	if cfg.AdminAddress == "" {
+		opts = append(opts, api.WithMetrics(metrics.Default.Handler()))
+	} else {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("GET /metrics", metrics.Default.Handler())
+		adminServer = newServer(cfg, cfg.AdminAddress, adminMux)
+	}
+	handler := api.NewHandler(st, pollster, opts...)
+	router := api.Router(handler)
+	server := newServer(cfg, cfg.RunAddress, router)
+	server.RegisterOnShutdown(handler.StopStreams)
+	errCh := make(chan error, 2)
+
+	if cfg.TLSCertFile != "" {
+		certs, err := tlscert.New(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		minVersion, _ := tlscert.MinVersion(cfg.TLSMinVersion)
+		server.TLSConfig = &tls.Config{MinVersion: minVersion, GetCertificate: certs.GetCertificate}
+		runWorker(func() { certs.Watch(workersCtx, cfg.TLSReloadInterval) })
+		go func() {
+			errCh <- server.ListenAndServeTLS("", "")
+		}()
+		slog.Info(fmt.Sprintf("service listening on %s with TLS %s+", cfg.RunAddress, cfg.TLSMinVersion))
+	} else {
+		go func() {
+			errCh <- server.ListenAndServe()
+		}()
+		slog.Info(fmt.Sprintf("service listening on %s", cfg.RunAddress))
+	}
+	if adminServer != nil {
+		go func() {
+			errCh <- adminServer.ListenAndServe()
+		}()
+		slog.Info(fmt.Sprintf("admin listener on %s", cfg.AdminAddress))
+	}
 
 	sigCh := make(chan os.Signal, 1) // we need to reserve to buffer size 1, so the notifier are not blocked
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGINT)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	usr1Ch := make(chan os.Signal, 1)
+	signal.Notify(usr1Ch, syscall.SIGUSR1)
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
 
+	var runErr error
+loop:
 	for {
 		select {
-		case <-sigCh:
-			slog.Info("calling SIGINT")
-			ctx, cancelCtx := context.WithTimeout(context.TODO(), 5*time.Second)
-			defer cancelCtx()
-			err := server.Shutdown(ctx)
-			if err != nil {
-				slog.Error(fmt.Sprintf("shutdown error: %s", err))
-				return err
-			}
-			slog.Info("service gracefully stopped")
-			return nil
-		case err := <-errCh:
-			return err
+		case <-hupCh:
+			cfg = reloadConfig(cfg, pollster, loginGuard, cors)
+		case <-usr1Ch:
+			toggleDebug(cfg.Level)
+		case sig := <-sigCh:
+			slog.Info("shutdown requested", slog.String("signal", sig.String()))
+			// readyz отвечает 503, балансировщик успевает убрать экземпляр до остановки сервера
+			checker.Drain()
+			time.Sleep(cfg.ShutdownDrainDelay)
+			break loop
+		case runErr = <-errCh:
+			break loop
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	// новые запросы не принимаются, начатые обрабатываются до конца
+	if adminServer != nil {
+		_ = adminServer.Shutdown(ctx)
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error(fmt.Sprintf("shutdown error: %s", err))
+		runErr = errors.Join(runErr, err)
+	}
+	stopWorkers()
+	workers.Wait()
+	// релей остановлен, публикатор больше не используется
+	if c, ok := publisher.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			slog.Error(fmt.Sprintf("close outbox publisher: %s", err))
+			runErr = errors.Join(runErr, err)
+		}
+	}
+	// опросы в процессе завершаются до своего срока, он не зависит от того, сколько ждали запросы;
+	// остаток очереди опрашивается после запуска любого экземпляра
+	pollCtx, cancelPoll := context.WithTimeout(context.Background(), cfg.ShutdownPollTimeout)
+	defer cancelPoll()
+	if left := pollster.Shutdown(pollCtx); left > 0 {
+		slog.Info("orders left in polling queue", slog.Int("orders", left))
+	}
+	slog.Info("service stopped")
+	return runErr
+}
+
+// newServer applies connection limits of config, so slow clients can't hold connections open
+func newServer(cfg conf.Config, addr string, h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+		MaxHeaderBytes:    cfg.HTTPMaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+func guardPolicy(cfg conf.Config) guard.Policy {
+	return guard.Policy{
+		MaxFailures:   cfg.LoginMaxFailures,
+		IPMaxFailures: cfg.LoginIPMaxFailures,
+		BaseDelay:     cfg.LoginBaseDelay,
+		MaxDelay:      cfg.LoginMaxDelay,
+		LockDuration:  cfg.LoginLockDuration,
+	}
+}
+
+// reloadConfig rereads config on SIGHUP and applies changed settings that don't need restart,
+// polling queue and connections are kept
+func reloadConfig(running conf.Config, pollster *polling.Pollster, loginGuard *guard.Guard, cors *api.CORS) conf.Config {
+	next, err := conf.InitConfig()
+	if err != nil {
+		slog.Error("config is not reloaded", slog.String("error", err.Error()))
+		return running
+	}
+	live, restart := running.Changed(next)
+	if len(restart) > 0 {
+		slog.Warn("changed settings need restart", slog.Any("settings", restart))
+	}
+	changed := func(keys ...string) bool {
+		return slices.ContainsFunc(keys, func(k string) bool { return slices.Contains(live, k) })
+	}
+	if changed("level") {
+		level, _ := logging.ParseLevel(next.Level)
+		lvl.Set(level)
+	}
+	if changed("poll_interval") {
+		pollster.SetInterval(time.Duration(next.PollInterval) * time.Second)
+	}
+	if changed("poll_concurrency") {
+		pollster.SetConcurrency(next.PollConcurrency)
+	}
+	if changed("accrual_rate_limit") {
+		pollster.SetRateLimit(next.AccrualRateLimit)
+	}
+	if changed("login_max_failures", "login_ip_max_failures", "login_base_delay", "login_max_delay", "login_lock_duration") {
+		loginGuard.SetPolicy(guardPolicy(next))
+	}
+	if changed("cors_origins") {
+		cors.SetOrigins(next.CORSOrigins)
+	}
+	slog.Info("config reloaded", slog.Any("applied", live))
+	return running.Reloaded(next)
+}
+
+// registerMetrics exposes connection pool and pollster state, they are read on every scrape
+func registerMetrics(st *store.Store, pollster *polling.Pollster) {
+	pool := []struct {
+		name, help string
+		value      func(*pgxpool.Stat) float64
+	}{
+		{"gophermart_db_pool_acquired_conns", "Connections currently in use.", func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) }},
+		{"gophermart_db_pool_idle_conns", "Idle connections in pool.", func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) }},
+		{"gophermart_db_pool_total_conns", "Total connections in pool.", func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) }},
+		{"gophermart_db_pool_max_conns", "Maximum size of pool.", func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) }},
+	}
+	for _, m := range pool {
+		value := m.value
+		metrics.NewGaugeFunc(m.name, m.help, func() float64 { return value(st.Stat()) })
+	}
+	metrics.NewCounterFunc("gophermart_db_pool_acquires_total", "Successful acquires of connection from pool.",
+		func() float64 { return float64(st.Stat().AcquireCount()) })
+	metrics.NewCounterFunc("gophermart_db_pool_empty_acquires_total", "Acquires that waited for connection because pool was empty.",
+		func() float64 { return float64(st.Stat().EmptyAcquireCount()) })
+	metrics.NewCounterFunc("gophermart_db_pool_acquire_seconds_total", "Total time spent acquiring connections.",
+		func() float64 { return st.Stat().AcquireDuration().Seconds() })
+
+	metrics.NewGaugeFunc("gophermart_pollster_queue_depth", "Orders waiting for the next poll of accrual system.",
+		func() float64 { return float64(pollster.QueueDepth()) })
+	metrics.NewGaugeFunc("gophermart_pollster_in_flight", "Requests to accrual system in progress.",
+		func() float64 { return float64(pollster.InFlight()) })
+	metrics.NewGaugeFunc("gophermart_accrual_rate_limit", "Current limit of requests per second to accrual system.",
+		pollster.RateLimit)
+}
+
+// newOutboxPublisher returns nil if publishing is disabled
+func newOutboxPublisher(cfg conf.Config) (outbox.Publisher, error) {
+	switch cfg.OutboxPublisher {
+	case "":
+		return nil, nil
+	case "stdout":
+		return outbox.NewWriterPublisher(os.Stdout), nil
+	case "file":
+		return outbox.NewFilePublisher(cfg.OutboxFile)
+	case "http":
+		if cfg.OutboxURL == "" {
+			return nil, errors.New("OutboxURL is required for http outbox publisher")
 		}
+		return outbox.NewHTTPPublisher(cfg.OutboxURL, 10*time.Second), nil
+	default:
+		return nil, fmt.Errorf("unknown outbox publisher %q", cfg.OutboxPublisher)
 	}
 }
 
@@ -95,7 +409,24 @@ func main() {
 		slog.Error(err.Error())
 		os.Exit(1)
 	}
-	setLogLevel(cfg.Level)
+	if cfg.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	setupLogger(cfg)
+	api.SetJWT(cfg.JWTSecret, cfg.JWTLifetime)
+	if cfg.JWTSecret == "" {
+		slog.Warn("jwt_secret is not set, tokens are signed with random key and expire on restart")
+	}
+	if cfg.LogPIIKey == "" {
+		slog.Info("log_pii_key is not set, personal data hashes in logs differ between processes")
+	}
+	if cfg.ConfigFile != "" {
+		slog.Info("config file loaded", slog.String("path", cfg.ConfigFile))
+	}
 	if err := mainWithError(cfg); err != nil {
 		slog.Error(fmt.Sprintf("service stopped with error: %s\n", err))
 		os.Exit(1)
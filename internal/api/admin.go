@@ -0,0 +1,225 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gophermart/internal/model"
+)
+
+const searchUsersLimit = 100
+
+// auditRecord describes admin action performed by the request with its result
+func auditRecord(r *http.Request, action, target, result string) AuditRecord {
+	return AuditRecord{
+		ActorID:   r.Context().Value(userIDCtxKey{}).(int),
+		Action:    action,
+		Target:    target,
+		Details:   r.Method + " " + r.URL.String() + ": " + result,
+		CreatedAt: time.Now(),
+	}
+}
+
+// audit writes successful admin action to audit log. Result is not sent to admin if it can't be recorded.
+// Changes of data are audited by store in their transactions instead.
+func (h *Handler) audit(w http.ResponseWriter, r *http.Request, action, target, result string) bool {
+	err := h.store.AddAudit(r.Context(), auditRecord(r, action, target, result))
+	if err != nil {
+		internalError(w, r, fmt.Errorf("audit %s %s: %w", action, target, err))
+		return false
+	}
+	return true
+}
+
+func pathUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || userID <= 0 {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid user id")
+		return 0, false
+	}
+	return userID, true
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, code int, v any) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		internalError(w, r, fmt.Errorf("marshal response: %w", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(resp)
+}
+
+func (h *Handler) AdminSearchUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	users, err := h.store.SearchUsers(r.Context(), query, searchUsersLimit)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if !h.audit(w, r, "search_users", "query:"+query, fmt.Sprintf("%d users found", len(users))) {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, users)
+}
+
+func (h *Handler) AdminUserOrders(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	orders, err := h.store.ListOrders(r.Context(), userID)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if !h.audit(w, r, "view_orders", fmt.Sprintf("user:%d", userID), fmt.Sprintf("%d orders", len(orders))) {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, orders)
+}
+
+func (h *Handler) AdminUserBalance(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	balance, err := h.store.GetBalance(r.Context(), userID)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if !h.audit(w, r, "view_balance", fmt.Sprintf("user:%d", userID), "ok") {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, balance)
+}
+
+func (h *Handler) AdminUserWithdrawals(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	payments, err := h.store.SpentBonusList(r.Context(), userID)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if !h.audit(w, r, "view_withdrawals", fmt.Sprintf("user:%d", userID), fmt.Sprintf("%d withdrawals", len(payments))) {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, payments)
+}
+
+func (h *Handler) AdminBlockUser(w http.ResponseWriter, r *http.Request) {
+	h.setBlocked(w, r, true)
+}
+
+func (h *Handler) AdminUnblockUser(w http.ResponseWriter, r *http.Request) {
+	h.setBlocked(w, r, false)
+}
+
+func (h *Handler) setBlocked(w http.ResponseWriter, r *http.Request, blocked bool) {
+	userID, ok := pathUserID(w, r)
+	action := "unblock_user"
+	if blocked {
+		action = "block_user"
+	}
+	if !ok {
+		return
+	}
+	rec := auditRecord(r, action, fmt.Sprintf("user:%d", userID), fmt.Sprintf("blocked:%t", blocked))
+	err := h.store.SetBlocked(r.Context(), userID, blocked, rec)
+	if errors.Is(err, model.ErrUserNotFound) {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "")
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// AdminRequeueOrder pushes order to pollster again, e.g. after accrual system outage
+func (h *Handler) AdminRequeueOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.PathValue("number"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidOrderNumber, "")
+		return
+	}
+	order, err := h.store.GetOrder(r.Context(), orderID)
+	if errors.Is(err, model.ErrNoOrder) {
+		writeError(w, r, http.StatusNotFound, codeOrderNotFound, "")
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	// повторный опрос обработанного заказа начислил бы баллы ещё раз
+	if order.Status == model.OrderStatusProcessed || order.Status == model.OrderStatusInvalid {
+		writeError(w, r, http.StatusConflict, codeOrderFinal, model.ErrOrderFinal.Error())
+		return
+	}
+	// постановка в очередь опроса не завершается ошибкой, поэтому аудит пишется до неё
+	if !h.audit(w, r, "requeue_order", fmt.Sprintf("order:%d", orderID), "requeued in status "+order.Status.String()) {
+		return
+	}
+	h.poller.Push(r.Context(), orderID)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// AdminAdjustBalance credits (positive amount) or debits (negative amount) user balance
+func (h *Handler) AdminAdjustBalance(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	var adj Adjustment
+	if err := json.NewDecoder(r.Body).Decode(&adj); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "malformed JSON body")
+		return
+	}
+	if adj.Amount == 0 || !adj.Reason.Valid() || adj.Comment == "" {
+		writeError(w, r, http.StatusBadRequest, codeInvalidAdjustment, "amount, known reason and comment are required")
+		return
+	}
+	adj.AdminID = r.Context().Value(userIDCtxKey{}).(int)
+	// запись аудита создаётся в транзакции изменения, отклонённые изменения не попадают в аудит
+	adj, err := h.store.AdjustBalance(r.Context(), userID, adj)
+	if err != nil {
+		if errors.Is(err, model.ErrUserNotFound) {
+			writeError(w, r, http.StatusNotFound, codeUserNotFound, "")
+			return
+		}
+		if errors.Is(err, model.ErrNotEnough) {
+			writeError(w, r, http.StatusConflict, codeInsufficientFunds, "debit would make balance negative")
+			return
+		}
+		internalError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, adj)
+}
+
+func (h *Handler) AdminUserAdjustments(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	adjustments, err := h.store.ListAdjustments(r.Context(), userID)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if !h.audit(w, r, "view_adjustments", fmt.Sprintf("user:%d", userID), fmt.Sprintf("%d adjustments", len(adjustments))) {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, adjustments)
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gophermart/internal/mock"
+	"gophermart/internal/model"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+func adminRequest(t *testing.T, method, url string, userID int, role model.Role) *http.Request {
+	return adminRequestWithBody(t, method, url, "", userID, role)
+}
+
+func adminRequestWithBody(t *testing.T, method, url, body string, userID int, role model.Role) *http.Request {
+	t.Helper()
+	tkn, err := BuildJWT(userID, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+tkn)
+	return req
+}
+
+func TestAdmin_Forbidden(t *testing.T) {
+	h := setupHandler(t)
+	m := h.store.(*mock.MockStore)
+	m.EXPECT().UserAccess(gomock.Any(), 7).Return(false, model.RoleUser, nil)
+
+	w := httptest.NewRecorder()
+	Router(h).ServeHTTP(w, adminRequest(t, http.MethodGet, "/api/admin/users?q=john", 7, model.RoleUser))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %v, want %v", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestAdmin_RoleFromStore(t *testing.T) {
+	h := setupHandler(t)
+	m := h.store.(*mock.MockStore)
+	// token claims admin role, but the role was revoked or the token is forged
+	m.EXPECT().UserAccess(gomock.Any(), 7).Return(false, model.RoleUser, nil)
+
+	w := httptest.NewRecorder()
+	Router(h).ServeHTTP(w, adminRequest(t, http.MethodGet, "/api/admin/users?q=john", 7, model.RoleAdmin))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %v, want %v", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestAdmin_BlockedUser(t *testing.T) {
+	h := setupHandler(t)
+	m := h.store.(*mock.MockStore)
+	m.EXPECT().UserAccess(gomock.Any(), 7).Return(true, model.RoleUser, nil)
+
+	w := httptest.NewRecorder()
+	Router(h).ServeHTTP(w, adminRequest(t, http.MethodGet, "/api/user/balance", 7, model.RoleUser))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %v, want %v", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestAdmin_Actions(t *testing.T) {
+	adminID := 1
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		reqBody string
+		action  string
+		target  string
+		// changes of data pass audit record to store, it's written in their transaction
+		setup      func(m *mock.MockStore, p *MockPoller, audit func(rec AuditRecord))
+		audited    bool
+		statusCode int
+	}{
+		{
+			name:   "search_users",
+			method: http.MethodGet,
+			url:    "/api/admin/users?q=john",
+			action: "search_users",
+			target: "query:john",
+			setup: func(m *mock.MockStore, _ *MockPoller, _ func(AuditRecord)) {
+				m.EXPECT().SearchUsers(gomock.Any(), "john", searchUsersLimit).Return([]UserInfo{{ID: 7, Login: "john"}}, nil)
+			},
+			audited:    true,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "search_users_failed",
+			method: http.MethodGet,
+			url:    "/api/admin/users?q=john",
+			setup: func(m *mock.MockStore, _ *MockPoller, _ func(AuditRecord)) {
+				m.EXPECT().SearchUsers(gomock.Any(), "john", searchUsersLimit).Return(nil, errors.New("connection refused"))
+			},
+			statusCode: http.StatusInternalServerError,
+		},
+		{
+			name:   "block_user",
+			method: http.MethodPost,
+			url:    "/api/admin/users/7/block",
+			action: "block_user",
+			target: "user:7",
+			setup: func(m *mock.MockStore, _ *MockPoller, audit func(AuditRecord)) {
+				m.EXPECT().SetBlocked(gomock.Any(), 7, true, gomock.Any()).DoAndReturn(
+					func(_ any, _ int, _ bool, rec AuditRecord) error {
+						audit(rec)
+						return nil
+					})
+			},
+			audited:    true,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "unblock_unknown_user",
+			method: http.MethodPost,
+			url:    "/api/admin/users/8/unblock",
+			setup: func(m *mock.MockStore, _ *MockPoller, _ func(AuditRecord)) {
+				m.EXPECT().SetBlocked(gomock.Any(), 8, false, gomock.Any()).Return(model.ErrUserNotFound)
+			},
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:   "requeue_order",
+			method: http.MethodPost,
+			url:    "/api/admin/orders/7992723465/requeue",
+			action: "requeue_order",
+			target: "order:7992723465",
+			setup: func(m *mock.MockStore, p *MockPoller, _ func(AuditRecord)) {
+				m.EXPECT().GetOrder(gomock.Any(), 7992723465).Return(&Order{ID: 7992723465, Status: model.OrderStatusProcessing}, nil)
+				p.EXPECT().Push(gomock.Any(), 7992723465)
+			},
+			audited:    true,
+			statusCode: http.StatusAccepted,
+		},
+		{
+			name:   "requeue_processed_order",
+			method: http.MethodPost,
+			url:    "/api/admin/orders/7992723465/requeue",
+			setup: func(m *mock.MockStore, _ *MockPoller, _ func(AuditRecord)) {
+				m.EXPECT().GetOrder(gomock.Any(), 7992723465).Return(&Order{ID: 7992723465, Status: model.OrderStatusProcessed}, nil)
+			},
+			statusCode: http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := setupHandler(t)
+			m := h.store.(*mock.MockStore)
+			m.EXPECT().UserAccess(gomock.Any(), adminID).Return(false, model.RoleAdmin, nil)
+			audited := false
+			audit := func(rec AuditRecord) {
+				audited = true
+				if rec.ActorID != adminID || rec.Action != tt.action || rec.Target != tt.target {
+					t.Errorf("unexpected audit record %+v", rec)
+				}
+			}
+			m.EXPECT().AddAudit(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ any, rec AuditRecord) error {
+					audit(rec)
+					return nil
+				}).AnyTimes()
+			tt.setup(m, h.poller.(*MockPoller), audit)
+
+			w := httptest.NewRecorder()
+			Router(h).ServeHTTP(w, adminRequestWithBody(t, tt.method, tt.url, tt.reqBody, adminID, model.RoleAdmin))
+
+			if w.Code != tt.statusCode {
+				t.Errorf("got status %v, want %v", w.Code, tt.statusCode)
+			}
+			if audited != tt.audited {
+				t.Errorf("got audited %v, want %v", audited, tt.audited)
+			}
+		})
+	}
+}
+
+// AdjustBalance writes audit record in its transaction, so rejected adjustments are not audited
+func TestAdmin_AdjustBalance(t *testing.T) {
+	adminID := 1
+	tests := []struct {
+		name       string
+		storeErr   error
+		statusCode int
+	}{
+		{name: "adjusted", statusCode: http.StatusOK},
+		{name: "below_zero", storeErr: model.ErrNotEnough, statusCode: http.StatusConflict},
+		{name: "unknown_user", storeErr: model.ErrUserNotFound, statusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := setupHandler(t)
+			m := h.store.(*mock.MockStore)
+			m.EXPECT().UserAccess(gomock.Any(), adminID).Return(false, model.RoleAdmin, nil)
+			m.EXPECT().AdjustBalance(gomock.Any(), 7, Adjustment{
+				Amount:  -50,
+				Reason:  model.ReasonCorrection,
+				Comment: "duplicate accrual",
+				AdminID: adminID,
+				Force:   true,
+			}).Return(Adjustment{ID: 1}, tt.storeErr)
+
+			w := httptest.NewRecorder()
+			body := `{"amount": -50, "reason": "correction", "comment": "duplicate accrual", "force": true}`
+			Router(h).ServeHTTP(w, adminRequestWithBody(t, http.MethodPost, "/api/admin/users/7/adjustments", body, adminID, model.RoleAdmin))
+
+			if w.Code != tt.statusCode {
+				t.Errorf("got status %v, want %v", w.Code, tt.statusCode)
+			}
+		})
+	}
+}
+
+func TestAdmin_AdjustBalanceValidation(t *testing.T) {
+	for _, body := range []string{
+		`{"amount": 0, "reason": "goodwill", "comment": "sorry"}`,
+		`{"amount": 10, "reason": "because", "comment": "sorry"}`,
+		`{"amount": 10, "reason": "goodwill"}`,
+	} {
+		h := setupHandler(t)
+		m := h.store.(*mock.MockStore)
+		m.EXPECT().UserAccess(gomock.Any(), 1).Return(false, model.RoleAdmin, nil)
+
+		w := httptest.NewRecorder()
+		Router(h).ServeHTTP(w, adminRequestWithBody(t, http.MethodPost, "/api/admin/users/7/adjustments", body, 1, model.RoleAdmin))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %v, want %v", body, w.Code, http.StatusBadRequest)
+		}
+	}
+}
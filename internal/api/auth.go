@@ -3,12 +3,21 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
 	"time"
 
+	"gophermart/internal/model"
+	"gophermart/internal/policy"
+
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -19,32 +28,103 @@ type Creds struct {
 	Pwd  string `json:"password"`
 }
 
-type commonAuth func(creds Creds) (userID int, httpCode int, err error)
+type commonAuth func(creds Creds) (user User, httpCode int, err error)
 
 func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	AuthCmnHandler(w, r,
-		func(creds Creds) (userID int, httpCode int, err error) {
-			userID, err = newUser(r.Context(), h.store, creds)
-			httpCode = http.StatusConflict
-			return userID, httpCode, err
+		func(creds Creds) (user User, httpCode int, err error) {
+			if h.policy != nil {
+				if err = h.policy.Check(creds.User, creds.Pwd); err != nil {
+					return user, http.StatusBadRequest, err
+				}
+			}
+			user.Role = model.RoleUser
+			user.ID, err = newUser(r.Context(), h.store, creds)
+			if errors.Is(err, model.ErrLoginTaken) {
+				return user, http.StatusConflict, policy.LoginTaken()
+			}
+			return user, http.StatusInternalServerError, err
 		},
 	)
 }
 
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	AuthCmnHandler(w, r,
-		func(creds Creds) (userID int, httpCode int, err error) {
-			userID, err = authUser(r.Context(), h.store, creds)
-			httpCode = http.StatusUnauthorized
-			return userID, httpCode, err
+		func(creds Creds) (user User, httpCode int, err error) {
+			if h.guard == nil {
+				user, err = authUser(r.Context(), h.store, creds)
+				return user, loginErrCode(err), err
+			}
+			ip := h.clientIP(r)
+			if wait := h.guard.Allow(r.Context(), creds.User, ip); wait > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				return user, http.StatusTooManyRequests, model.ErrLoginThrottled
+			}
+			user, err = authUser(r.Context(), h.store, creds)
+			switch {
+			case errors.Is(err, errAuthFailed):
+				h.guard.Fail(r.Context(), creds.User, ip)
+			case err != nil:
+				// пароль не проверялся или верный, но пользователь заблокирован
+				h.guard.Release(r.Context(), creds.User, ip)
+			default:
+				h.guard.Succeed(r.Context(), creds.User, ip)
+				return user, http.StatusOK, nil
+			}
+			return user, loginErrCode(err), err
 		},
 	)
 }
 
+func loginErrCode(err error) int {
+	switch {
+	case errors.Is(err, model.ErrUserBlocked):
+		return http.StatusForbidden
+	case errors.Is(err, errAuthFailed):
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+// clientIP is the address of connection, or if it comes from trusted proxy, the nearest untrusted
+// address of X-Forwarded-For. Hops are checked from the right, the client may forge the rest of the header.
+func (h *Handler) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !h.trustedProxy(ip) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap()
+		if !h.trustedProxy(ip) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+func (h *Handler) trustedProxy(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, p := range h.trustedProxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func AuthCmnHandler(w http.ResponseWriter, r *http.Request, auth commonAuth) {
 	if r.Header.Get("Content-Type") != "application/json" ||
 		r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "expected POST with application/json body")
 		return
 	}
 	creds := Creds{}
@@ -52,28 +132,42 @@ func AuthCmnHandler(w http.ResponseWriter, r *http.Request, auth commonAuth) {
 	// читаем тело запроса
 	_, err := buf.ReadFrom(r.Body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "unable to read body")
 		return
 	}
 	if err = json.Unmarshal(buf.Bytes(), &creds); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "malformed JSON body")
 		return
 	}
 	if creds.User == "" || creds.Pwd == "" {
-		http.Error(w, "empty login or password", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "empty login or password")
 		return
 	}
-	var userID, httpErrCode int
-	userID, httpErrCode, err = auth(creds)
+	var user User
+	var httpErrCode int
+	user, httpErrCode, err = auth(creds)
 	if err != nil {
-		http.Error(w, err.Error(), httpErrCode)
+		if p, ok := policyProblem(httpErrCode, err); ok {
+			writeProblem(w, r, p)
+			return
+		}
+		switch httpErrCode {
+		case http.StatusUnauthorized:
+			writeError(w, r, httpErrCode, codeInvalidCredentials, "invalid login or password")
+		case http.StatusForbidden:
+			writeError(w, r, httpErrCode, codeUserBlocked, "")
+		case http.StatusTooManyRequests:
+			writeError(w, r, httpErrCode, codeTooManyLoginAttempts, "retry after delay given in Retry-After header")
+		default:
+			internalError(w, r, err)
+		}
 		return
 	}
 
 	var tkn string
-	tkn, err = BuildJWT(userID)
+	tkn, err = BuildJWT(user.ID, user.Role)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
 	w.Header().Set("Authorization", "Bearer "+tkn)
@@ -91,42 +185,76 @@ func newUser(ctx context.Context, store Store, creds Creds) (int, error) {
 	})
 }
 
-func authUser(ctx context.Context, store Store, creds Creds) (int, error) {
+// errAuthFailed - неизвестный логин или неверный пароль
+var errAuthFailed = errors.New("auth failed")
+
+func authUser(ctx context.Context, store Store, creds Creds) (User, error) {
 	u, err := store.GetUser(ctx, creds.User)
+	if errors.Is(err, model.ErrUserNotFound) {
+		return User{}, errAuthFailed
+	}
 	if err != nil {
-		return 0, errors.New("auth failed")
+		return User{}, err
 	}
 	err = bcrypt.CompareHashAndPassword(u.Hash, []byte(creds.Pwd))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return User{}, errAuthFailed
+	}
 	if err != nil {
-		return 0, errors.New("auth failed")
+		return User{}, err
 	}
-	return u.ID, nil
+	if u.Blocked {
+		return User{}, model.ErrUserBlocked
+	}
+	return *u, nil
 }
 
 // Claims — структура утверждений, которая включает стандартные утверждения и
-// одно пользовательское userID
+// пользовательские userID и роль
 type Claims struct {
 	jwt.RegisteredClaims
 	UserID int
+	Role   model.Role `json:",omitempty"`
 }
 
-const TokenExp = time.Hour * 24
-const SecretKey = "supersecretkey"
+// параметры токенов, меняются при запуске через SetJWT
+var (
+	tokenExp  = time.Hour * 24
+	secretKey = randomKey()
+)
+
+func randomKey() []byte {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// SetJWT sets signing key and lifetime of tokens, it must be called before serving.
+// Empty secret keeps random key of the process, tokens are invalidated by restart.
+func SetJWT(secret string, lifetime time.Duration) {
+	if secret != "" {
+		secretKey = []byte(secret)
+	}
+	tokenExp = lifetime
+}
 
 // BuildJWT создаёт токен и возвращает его в виде строки.
-func BuildJWT(user int) (string, error) {
+func BuildJWT(user int, role model.Role) (string, error) {
 	// создаём новый токен с алгоритмом подписи HS256 и утверждениями — Claims
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			// когда создан токен
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenExp)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExp)),
 		},
-		// собственное утверждение
+		// собственные утверждения
 		UserID: user,
+		Role:   role,
 	})
 
 	// создаём строку токена
-	tokenString, err := token.SignedString([]byte(SecretKey))
+	tokenString, err := token.SignedString(secretKey)
 	if err != nil {
 		return "", err
 	}
@@ -135,14 +263,14 @@ func BuildJWT(user int) (string, error) {
 	return tokenString, nil
 }
 
-func getUserID(tokenString string) (*int, error) {
+func parseClaims(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims,
 		func(t *jwt.Token) (any, error) {
 			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 			}
-			return []byte(SecretKey), nil
+			return secretKey, nil
 		})
 	if err != nil {
 		return nil, err
@@ -151,5 +279,9 @@ func getUserID(tokenString string) (*int, error) {
 	if !token.Valid {
 		return nil, errors.New("invalid token")
 	}
-	return &claims.UserID, nil
+	if claims.Role == "" {
+		// токены, выданные до появления ролей
+		claims.Role = model.RoleUser
+	}
+	return claims, nil
 }
@@ -3,13 +3,18 @@ package api
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"testing"
+	"time"
 
 	"gophermart/internal/mock"
+	"gophermart/internal/model"
+	"gophermart/internal/policy"
 
 	"net/http/httptest"
+	"net/netip"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -89,6 +94,17 @@ func TestHandler_Register(t *testing.T) {
 				statusCode: http.StatusConflict,
 			},
 			mockUser: User{ID: 0},
+			mockErr:  model.ErrLoginTaken,
+			reqBody:  `{"login": "user", "password": "123456"}`,
+		},
+		{
+			name:   "register_store_error_status_code_500",
+			url:    "/api/user/register",
+			method: http.MethodPost,
+			want: want{
+				statusCode: http.StatusInternalServerError,
+			},
+			mockUser: User{ID: 0},
 			mockErr:  errors.New("failed to add user"),
 			reqBody:  `{"login": "user", "password": "123456"}`,
 		},
@@ -169,8 +185,18 @@ func TestHandler_Login(t *testing.T) {
 			want: want{
 				statusCode: http.StatusUnauthorized,
 			},
-			mockUser: User{ID: 0},
-			reqBody:  `{"login": "user", "password": "123456"}`,
+			mockErr: model.ErrUserNotFound,
+			reqBody: `{"login": "user", "password": "123456"}`,
+		},
+		{
+			name:   "login_status_code_500",
+			url:    "/api/user/login",
+			method: http.MethodPost,
+			want: want{
+				statusCode: http.StatusInternalServerError,
+			},
+			mockErr: errors.New("connection refused"),
+			reqBody: `{"login": "user", "password": "123456"}`,
 		},
 	}
 	for _, tt := range tests {
@@ -198,3 +224,151 @@ func TestHandler_Login(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_LoginThrottled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockStore := mock.NewMockStore(ctrl)
+	mockGuard := NewMockLoginGuard(ctrl)
+	h := NewHandler(mockStore, NewMockPoller(ctrl), WithLoginGuard(mockGuard))
+
+	newReq := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/login", bytes.NewBufferString(`{"login": "user", "password": "wrong"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "10.0.0.1:5555"
+		return req
+	}
+
+	t.Run("login_failure_is_registered", func(t *testing.T) {
+		mockGuard.EXPECT().Allow(gomock.Any(), "user", "10.0.0.1").Return(time.Duration(0))
+		mockStore.EXPECT().GetUser(gomock.Any(), "user").Return(&User{ID: 1, Hash: []byte("$2a$10$35jb2VUM8yhqH/NtLh.r7ujcLFJScQmu6XwRcTEuSENFbFxFn6eL2")}, nil)
+		mockGuard.EXPECT().Fail(gomock.Any(), "user", "10.0.0.1")
+		w := httptest.NewRecorder()
+		h.Login(w, newReq())
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("got status %v, want %v", w.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("database_error_releases_attempt", func(t *testing.T) {
+		mockGuard.EXPECT().Allow(gomock.Any(), "user", "10.0.0.1").Return(time.Duration(0))
+		mockStore.EXPECT().GetUser(gomock.Any(), "user").Return(nil, errors.New("connection refused"))
+		mockGuard.EXPECT().Release(gomock.Any(), "user", "10.0.0.1")
+		w := httptest.NewRecorder()
+		h.Login(w, newReq())
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("got status %v, want %v", w.Code, http.StatusInternalServerError)
+		}
+	})
+
+	t.Run("login_status_code_429", func(t *testing.T) {
+		mockGuard.EXPECT().Allow(gomock.Any(), "user", "10.0.0.1").Return(1500 * time.Millisecond)
+		w := httptest.NewRecorder()
+		h.Login(w, newReq())
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("got status %v, want %v", w.Code, http.StatusTooManyRequests)
+		}
+		if got := w.Header().Get("Retry-After"); got != "2" {
+			t.Errorf("got Retry-After %q, want %q", got, "2")
+		}
+	})
+}
+
+func TestHandler_clientIP(t *testing.T) {
+	h := NewHandler(nil, nil, WithTrustedProxies([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}))
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{name: "direct", remoteAddr: "203.0.113.7:5555", want: "203.0.113.7"},
+		{name: "forged_header_from_client", remoteAddr: "203.0.113.7:5555", forwarded: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "trusted_proxy", remoteAddr: "10.0.0.1:5555", forwarded: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "proxy_chain", remoteAddr: "10.0.0.1:5555", forwarded: []string{"192.0.2.9, 198.51.100.1, 10.1.1.1"}, want: "198.51.100.1"},
+		{name: "several_headers", remoteAddr: "10.0.0.1:5555", forwarded: []string{"192.0.2.9", "198.51.100.1"}, want: "198.51.100.1"},
+		{name: "ipv6_proxy", remoteAddr: "[2001:db8::1]:5555", forwarded: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "malformed_hop", remoteAddr: "10.0.0.1:5555", forwarded: []string{"198.51.100.1, unknown"}, want: "10.0.0.1"},
+		{name: "no_header", remoteAddr: "10.0.0.1:5555", want: "10.0.0.1"},
+		{name: "only_proxies", remoteAddr: "10.0.0.1:5555", forwarded: []string{"10.2.2.2"}, want: "10.2.2.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/login", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := h.clientIP(req); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_RegisterPolicy(t *testing.T) {
+	p, err := policy.New(3, 16, "[a-z]", 8, 72, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		reqBody    string
+		mockErr    error
+		callStore  bool
+		statusCode int
+		rule       string
+	}{
+		{
+			name:       "common_password",
+			reqBody:    `{"login": "user", "password": "password1"}`,
+			statusCode: http.StatusBadRequest,
+			rule:       policy.RulePasswordCommon,
+		},
+		{
+			name:       "login_charset",
+			reqBody:    `{"login": "user!", "password": "k7#pQ9vz"}`,
+			statusCode: http.StatusBadRequest,
+			rule:       policy.RuleLoginCharset,
+		},
+		{
+			name:       "login_taken",
+			reqBody:    `{"login": "user", "password": "k7#pQ9vz"}`,
+			mockErr:    model.ErrLoginTaken,
+			callStore:  true,
+			statusCode: http.StatusConflict,
+			rule:       policy.RuleLoginTaken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockStore := mock.NewMockStore(ctrl)
+			h := NewHandler(mockStore, NewMockPoller(ctrl), WithCredsPolicy(p))
+			if tt.callStore {
+				mockStore.EXPECT().AddUser(gomock.Any(), gomock.Any()).Return(0, tt.mockErr)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/user/register", bytes.NewBufferString(tt.reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			h.Register(w, req)
+
+			if w.Code != tt.statusCode {
+				t.Errorf("got status %v, want %v", w.Code, tt.statusCode)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != problemContentType {
+				t.Errorf("got content type %s, want %s", ct, problemContentType)
+			}
+			var p Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Rule != tt.rule || p.Field == "" {
+				t.Errorf("got problem %+v, want rule %s", p, tt.rule)
+			}
+		})
+	}
+}
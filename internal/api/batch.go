@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"gophermart/internal/helpers"
+	"gophermart/internal/model"
+	"gophermart/internal/tracing"
+
+	"github.com/theplant/luhn"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type OrderUpload = model.OrderUpload
+
+// batchItemMaxSize bounds body of batch upload together with batch limit:
+// order number in quotes with comma and indentation
+const batchItemMaxSize = 64
+
+var errBatchTooLarge = errors.New("batch is too large")
+
+// parseOrderNumber accepts order number as JSON string or number
+func parseOrderNumber(raw json.RawMessage) (string, int, error) {
+	var number string
+	if err := json.Unmarshal(raw, &number); err != nil {
+		var n json.Number
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return string(raw), 0, err
+		}
+		number = n.String()
+	}
+	orderID, err := helpers.Atoi([]byte(number))
+	return number, orderID, err
+}
+
+// decodeBatch reads JSON array item by item and stops as soon as there are more than limit items
+func decodeBatch(body io.Reader, limit int) ([]json.RawMessage, error) {
+	dec := json.NewDecoder(body)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return nil, errors.New("body is not JSON array")
+	}
+	var items []json.RawMessage
+	for dec.More() {
+		if len(items) == limit {
+			return nil, errBatchTooLarge
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		items = append(items, raw)
+	}
+	// закрывающая скобка
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// NewOrderBatch uploads JSON array of order numbers and returns result for every item
+func (h *Handler) NewOrderBatch(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, int64(h.batchLimit+1)*batchItemMaxSize)
+	items, err := decodeBatch(r.Body, h.batchLimit)
+	var tooLarge *http.MaxBytesError
+	if errors.Is(err, errBatchTooLarge) || errors.As(err, &tooLarge) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, codeBatchTooLarge, fmt.Sprintf("batch is limited to %d orders", h.batchLimit))
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "body must be JSON array of order numbers")
+		return
+	}
+	if len(items) == 0 {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "empty batch")
+		return
+	}
+
+	results := make([]OrderUpload, len(items))
+	// позиции каждого номера в запросе, один номер может встретиться несколько раз
+	positions := make(map[int][]int)
+	orderIDs := make([]int, 0, len(items))
+	for i, raw := range items {
+		number, orderID, err := parseOrderNumber(raw)
+		results[i] = OrderUpload{Number: number, ID: orderID}
+		switch {
+		case err != nil || orderID <= 0:
+			results[i].Result = model.UploadMalformed
+		case !luhn.Valid(orderID):
+			results[i].Result = model.UploadInvalidNumber
+		default:
+			if _, ok := positions[orderID]; !ok {
+				orderIDs = append(orderIDs, orderID)
+			}
+			positions[orderID] = append(positions[orderID], i)
+		}
+	}
+
+	if len(orderIDs) > 0 {
+		userID := r.Context().Value(userIDCtxKey{}).(int)
+		trace.SpanFromContext(r.Context()).SetAttributes(tracing.AttrOrderID.IntSlice(orderIDs))
+		uploads, err := h.store.AddOrders(r.Context(), orderIDs, userID)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+		toPoll := make([]int, 0, len(uploads))
+		for _, u := range uploads {
+			for n, i := range positions[u.ID] {
+				results[i].Result = u.Result
+				if n > 0 && u.Result == model.UploadAccepted {
+					results[i].Result = model.UploadAlreadyUploaded
+				}
+			}
+			if u.Result == model.UploadAccepted ||
+				(u.Result == model.UploadAlreadyUploaded && u.Status != model.OrderStatusProcessed && u.Status != model.OrderStatusInvalid) {
+				toPoll = append(toPoll, u.ID)
+			}
+		}
+		if len(toPoll) > 0 {
+			h.poller.PushBatch(r.Context(), toPoll)
+		}
+	}
+	writeJSON(w, r, http.StatusOK, results)
+}
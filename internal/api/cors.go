@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"sync/atomic"
+)
+
+// CORS lets browser frontends on allowed origins call the API, origins are replaced on config reload
+type CORS struct {
+	origins atomic.Pointer[[]string]
+}
+
+// NewCORS allows listed origins, "*" allows any origin
+func NewCORS(origins []string) *CORS {
+	c := &CORS{}
+	c.SetOrigins(origins)
+	return c
+}
+
+func (c *CORS) SetOrigins(origins []string) {
+	origins = slices.Clone(origins)
+	c.origins.Store(&origins)
+}
+
+func (c *CORS) allowed(origin string) bool {
+	origins := *c.origins.Load()
+	return slices.Contains(origins, "*") || slices.Contains(origins, origin)
+}
+
+// WithCORS adds CORS headers for allowed origins and answers preflight requests
+func WithCORS(c *CORS) HandlerOption {
+	return func(h *Handler) {
+		h.cors = c
+	}
+}
+
+// middleware wraps whole router: preflight OPTIONS requests match no route
+func (c *CORS) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" || !c.allowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		// токен после входа возвращается в заголовке Authorization
+		w.Header().Set("Access-Control-Expose-Headers", "Authorization, "+requestIDHeader)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Last-Event-ID, "+requestIDHeader)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	cors := NewCORS([]string{"https://shop.example"})
+	router := Router(NewHandler(nil, nil, WithCORS(cors)))
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "/api/user/orders", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := preflight("https://shop.example")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://shop.example" {
+		t.Errorf("preflight of allowed origin: got status %v, headers %v", w.Code, w.Header())
+	}
+	if w := preflight("https://evil.example"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("unknown origin is allowed: %v", w.Header())
+	}
+
+	// источники меняются без пересоздания роутера
+	cors.SetOrigins([]string{"https://evil.example"})
+	if w := preflight("https://shop.example"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("removed origin is still allowed: %v", w.Header())
+	}
+	if w := preflight("https://evil.example"); w.Code != http.StatusNoContent {
+		t.Errorf("added origin is not allowed, got status %v", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "https://evil.example" {
+		t.Errorf("simple request: got status %v, headers %v", w.Code, w.Header())
+	}
+}
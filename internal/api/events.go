@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gophermart/internal/model"
+)
+
+type UserEvent = model.UserEvent
+
+const (
+	eventsReplayLimit = 1000
+	eventsKeepAlive   = 15 * time.Second
+)
+
+// EventSource delivers user events of all instances
+type EventSource interface {
+	Subscribe(userID int) (<-chan UserEvent, func())
+}
+
+// WithEvents enables real-time notifications
+func WithEvents(src EventSource) HandlerOption {
+	return func(h *Handler) {
+		h.events = src
+	}
+}
+
+// StopStreams ends SSE and WebSocket streams, it's registered with http.Server.RegisterOnShutdown:
+// Shutdown doesn't cancel requests and doesn't track hijacked connections, so streams would hold it until timeout
+func (h *Handler) StopStreams() {
+	h.stopStreams.Do(func() {
+		close(h.streamsDone)
+	})
+}
+
+// streamContext is canceled when request is done or streams are stopped
+func (h *Handler) streamContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-h.streamsDone:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// subscribe returns live events of user preceded by events missed since lastID.
+// If some of missed events are pruned or there are too many of them, resync event is sent instead.
+func (h *Handler) subscribe(ctx context.Context, userID int, lastID int64) (<-chan UserEvent, func(), error) {
+	// подписываемся до чтения пропущенных событий, чтобы не потерять произошедшие между ними
+	live, cancel := h.events.Subscribe(userID)
+	var missed []UserEvent
+	if lastID > 0 {
+		var err error
+		// вместе с последним полученным событием: если его уже нет, удалены и следующие за ним
+		missed, err = h.store.ListUserEvents(ctx, userID, lastID-1, eventsReplayLimit+2)
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		if len(missed) == 0 || missed[0].ID != lastID || len(missed) > eventsReplayLimit+1 {
+			// id 0 сбрасывает Last-Event-ID клиента
+			missed = []UserEvent{{UserID: userID, Type: model.EventResync, Data: []byte(`{}`), CreatedAt: time.Now()}}
+		} else {
+			missed = missed[1:]
+		}
+	}
+	out := make(chan UserEvent)
+	done := make(chan struct{})
+	go func() {
+		defer close(out)
+		sent := lastID
+		send := func(ev UserEvent) bool {
+			if ev.ID <= sent && ev.Type != model.EventResync {
+				return true
+			}
+			select {
+			case out <- ev:
+				sent = ev.ID
+				return true
+			case <-done:
+				return false
+			}
+		}
+		for _, ev := range missed {
+			if !send(ev) {
+				return
+			}
+		}
+		for ev := range live {
+			if !send(ev) {
+				return
+			}
+		}
+	}()
+	stop := func() {
+		close(done)
+		cancel()
+	}
+	return out, stop, nil
+}
+
+// OrderEvents streams user events as Server-Sent Events. Client may resume with Last-Event-ID header.
+func (h *Handler) OrderEvents(w http.ResponseWriter, r *http.Request) {
+	if h.events == nil {
+		writeError(w, r, http.StatusNotImplemented, codeNotImplemented, "real-time events are disabled")
+		return
+	}
+	var lastID int64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		var err error
+		if lastID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid Last-Event-ID")
+			return
+		}
+	}
+	userID := r.Context().Value(userIDCtxKey{}).(int)
+	ctx, cancel := h.streamContext(r.Context())
+	defer cancel()
+	events, stop, err := h.subscribe(ctx, userID, lastID)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	defer stop()
+
+	rc := http.NewResponseController(w)
+	// поток длится дольше, чем допускает WriteTimeout сервера
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case ev, ok := <-events:
+			if !ok {
+				// подписка сброшена, клиент переподключится с Last-Event-ID
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gophermart/internal/events"
+	"gophermart/internal/mock"
+	"gophermart/internal/model"
+
+	gomock "github.com/golang/mock/gomock"
+	"golang.org/x/net/websocket"
+)
+
+func TestHandler_OrderEvents(t *testing.T) {
+	userID := 77
+	h := setupHandler(t)
+	broker := events.NewBroker()
+	h.events = broker
+
+	data, _ := json.Marshal(model.OrderEventData{Number: 7992723465, Status: model.OrderStatusProcessing})
+	missed := []UserEvent{{ID: 5, UserID: userID, Type: model.EventOrderStatus, Data: data}}
+	m := h.store.(*mock.MockStore)
+	m.EXPECT().ListUserEvents(gomock.Any(), userID, int64(3), eventsReplayLimit+2).
+		Return(append([]UserEvent{{ID: 4, UserID: userID}}, missed...), nil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), userIDCtxKey{}, userID)
+		h.OrderEvents(w, r.WithContext(ctx))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	req.Header.Set("Last-Event-ID", "4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("got content type %s", ct)
+	}
+
+	// событие 5 уже отправлено при восстановлении и не должно повториться
+	broker.Publish(missed[0])
+	broker.Publish(UserEvent{ID: 6, UserID: userID, Type: model.EventBalanceChanged, Data: []byte(`{"current":500,"withdrawn":0}`)})
+	broker.Publish(UserEvent{ID: 7, UserID: userID + 1, Type: model.EventBalanceChanged, Data: []byte(`{}`)})
+
+	var ids []string
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() && len(ids) < 2 {
+		if id, ok := strings.CutPrefix(sc.Text(), "id: "); ok {
+			ids = append(ids, id)
+		}
+	}
+	if strings.Join(ids, ",") != "5,6" {
+		t.Errorf("got event ids %v, want [5 6]", ids)
+	}
+}
+
+func TestHandler_UserWS(t *testing.T) {
+	userID := 78
+	h := setupHandler(t)
+	broker := events.NewBroker()
+	h.events = broker
+
+	data, _ := json.Marshal(model.OrderEventData{Number: 7992723465, Status: model.OrderStatusProcessing})
+	missed := []UserEvent{{ID: 5, UserID: userID, Type: model.EventOrderStatus, Data: data}}
+	m := h.store.(*mock.MockStore)
+	m.EXPECT().UserAccess(gomock.Any(), userID).Return(false, model.RoleUser, nil)
+	m.EXPECT().ListUserEvents(gomock.Any(), userID, int64(3), eventsReplayLimit+2).
+		Return(append([]UserEvent{{ID: 4, UserID: userID}}, missed...), nil)
+
+	server := httptest.NewServer(Router(h))
+	defer server.Close()
+
+	tkn, _ := BuildJWT(userID, model.RoleUser)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/user/ws?last_event_id=4&token=" + tkn
+	ws, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	_ = ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var msg wsMessage
+	if err := websocket.JSON.Receive(ws, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != 5 || msg.Type != model.EventOrderStatus {
+		t.Fatalf("got message %+v, want replayed event 5", msg)
+	}
+
+	// подписка уже создана, раз пришло восстановленное событие
+	broker.Publish(UserEvent{ID: 6, UserID: userID, Type: model.EventWithdrawal, Data: []byte(`{"order":"2377225624","sum":751}`)})
+	if err := websocket.JSON.Receive(ws, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != 6 || msg.Type != model.EventWithdrawal {
+		t.Errorf("got message %+v, want withdrawal event 6", msg)
+	}
+}
+
+func TestHandler_subscribeResync(t *testing.T) {
+	userID := 79
+	many := make([]UserEvent, eventsReplayLimit+2)
+	for i := range many {
+		many[i] = UserEvent{ID: int64(4 + i), UserID: userID, Type: model.EventBalanceChanged}
+	}
+	tests := []struct {
+		name   string
+		stored []UserEvent
+		want   UserEvent
+	}{
+		{
+			name:   "replayed",
+			stored: []UserEvent{{ID: 4}, {ID: 9, Type: model.EventBalanceChanged}},
+			want:   UserEvent{ID: 9, Type: model.EventBalanceChanged},
+		},
+		{
+			name:   "last_event_pruned",
+			stored: []UserEvent{{ID: 9, Type: model.EventBalanceChanged}},
+			want:   UserEvent{Type: model.EventResync},
+		},
+		{
+			name: "nothing_left",
+			want: UserEvent{Type: model.EventResync},
+		},
+		{
+			name:   "too_many_missed",
+			stored: many,
+			want:   UserEvent{Type: model.EventResync},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := setupHandler(t)
+			h.events = events.NewBroker()
+			m := h.store.(*mock.MockStore)
+			m.EXPECT().ListUserEvents(gomock.Any(), userID, int64(3), eventsReplayLimit+2).Return(tt.stored, nil)
+
+			out, stop, err := h.subscribe(context.Background(), userID, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stop()
+			select {
+			case ev := <-out:
+				if ev.ID != tt.want.ID || ev.Type != tt.want.Type {
+					t.Errorf("got event %d %s, want %d %s", ev.ID, ev.Type, tt.want.ID, tt.want.Type)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no event")
+			}
+		})
+	}
+}
+
+func TestHandler_UserWSUnauthorized(t *testing.T) {
+	h := setupHandler(t)
+	h.events = events.NewBroker()
+	server := httptest.NewServer(Router(h))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/user/ws?token=bad"
+	if _, err := websocket.Dial(url, "", server.URL); err == nil {
+		t.Error("handshake with invalid token succeeded")
+	}
+}
+
+func TestHandler_StopStreams(t *testing.T) {
+	userID := 79
+	h := setupHandler(t)
+	h.events = events.NewBroker()
+	h.streamsDone = make(chan struct{})
+	m := h.store.(*mock.MockStore)
+	m.EXPECT().UserAccess(gomock.Any(), userID).Return(false, model.RoleUser, nil).Times(2)
+
+	server := httptest.NewUnstartedServer(Router(h))
+	server.Config.RegisterOnShutdown(h.StopStreams)
+	server.Start()
+	defer server.Close()
+
+	tkn, _ := BuildJWT(userID, model.RoleUser)
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/user/orders/events", nil)
+	req.Header.Set("Authorization", "Bearer "+tkn)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/user/ws?token="+tkn, "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// открытые потоки не задерживают остановку сервера до истечения срока
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown waited for streams: %v", err)
+	}
+	_ = ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg wsMessage
+	if err := websocket.JSON.Receive(ws, &msg); err == nil {
+		t.Error("WebSocket connection is not closed on shutdown")
+	}
+}
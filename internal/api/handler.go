@@ -8,11 +8,21 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"gophermart/internal/health"
 	"gophermart/internal/helpers"
+	"gophermart/internal/logging"
 	"gophermart/internal/model"
+	"gophermart/internal/policy"
+	"gophermart/internal/tracing"
 
 	"github.com/theplant/luhn"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type User = model.User
@@ -21,76 +31,194 @@ type OrderStatus = model.OrderStatus
 type Balance = model.Balance
 type Payment = model.Payment
 type PaymentFact = model.PaymentFact
+type UserInfo = model.UserInfo
+type AuditRecord = model.AuditRecord
+type Adjustment = model.Adjustment
+type MerchantKey = model.MerchantKey
+type Webhook = model.Webhook
 
 //go:generate mockgen -destination ../mock/store_mock.go -package mock gophermart/internal/api Store
 type Store interface {
 	AddUser(ctx context.Context, u User) (int, error)
 	GetUser(ctx context.Context, login string) (*User, error)
-	AddOrder(ctx context.Context, orderID int, userID int) (OrderStatus, error)
+	// AddOrder saves new order of user, merchantKeyID is set when merchant uploads it and 0 otherwise
+	AddOrder(ctx context.Context, orderID int, userID int, merchantKeyID int) (OrderStatus, error)
+	AddOrders(ctx context.Context, orderIDs []int, userID int) ([]model.OrderUpload, error)
 	ListOrders(ctx context.Context, userID int) ([]Order, error)
+	ListOrdersPage(ctx context.Context, userID int, filter model.OrderFilter) ([]Order, error)
+	GetOrderHistory(ctx context.Context, orderID int) ([]model.OrderStatusEvent, error)
 	GetBalance(ctx context.Context, userID int) (*Balance, error)
 	SpendBonus(ctx context.Context, userID int, payment Payment) error
 	SpentBonusList(ctx context.Context, userID int) ([]PaymentFact, error)
+	SpentBonusPage(ctx context.Context, userID int, filter model.PaymentFilter) ([]PaymentFact, error)
+	SpentBonusSummary(ctx context.Context, userID int, from, to time.Time) (model.WithdrawalSummary, error)
+	UserAccess(ctx context.Context, userID int) (blocked bool, role model.Role, err error)
+	SearchUsers(ctx context.Context, query string, limit int) ([]UserInfo, error)
+	SetBlocked(ctx context.Context, userID int, blocked bool, rec AuditRecord) error
+	GetOrder(ctx context.Context, orderID int) (*Order, error)
+	AddAudit(ctx context.Context, rec AuditRecord) error
+	AdjustBalance(ctx context.Context, userID int, adj Adjustment) (Adjustment, error)
+	ListAdjustments(ctx context.Context, userID int) ([]Adjustment, error)
+	ListUserEvents(ctx context.Context, userID int, afterID int64, limit int) ([]UserEvent, error)
+	AddMerchantKey(ctx context.Context, key MerchantKey, rec AuditRecord) (int, error)
+	GetMerchantKey(ctx context.Context, hash []byte) (*MerchantKey, error)
+	ListMerchantKeys(ctx context.Context) ([]MerchantKey, error)
+	RevokeMerchantKey(ctx context.Context, id int, rec AuditRecord) error
+	AddWebhook(ctx context.Context, wh Webhook) (int, error)
+	ListWebhooks(ctx context.Context, owner model.WebhookOwner) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, owner model.WebhookOwner, id int) error
+	ListWebhookDeliveries(ctx context.Context, owner model.WebhookOwner, webhookID int, limit int) ([]model.WebhookDelivery, error)
+	RedeliverWebhook(ctx context.Context, owner model.WebhookOwner, webhookID int, deliveryID int64) error
 }
 
 //go:generate mockgen -destination ./poller_mock.go -package api gophermart/internal/api Poller
 type Poller interface {
-	Push(orderID int)
+	// ctx only passes request log fields to polling, it may be already canceled when order is polled
+	Push(ctx context.Context, orderID int)
+	PushBatch(ctx context.Context, orderIDs []int)
+}
+
+//go:generate mockgen -destination ./guard_mock.go -package api gophermart/internal/api LoginGuard
+type LoginGuard interface {
+	// Allow reserves attempt, permitted one is finished with Fail, Succeed or Release
+	Allow(ctx context.Context, login, ip string) time.Duration
+	Fail(ctx context.Context, login, ip string)
+	Succeed(ctx context.Context, login, ip string)
+	Release(ctx context.Context, login, ip string)
 }
 
 type Handler struct {
 	store  Store
 	poller Poller
+	guard  LoginGuard
+	policy *policy.Policy
+	// maximum number of orders in batch upload
+	batchLimit int
+	events     EventSource
+	// проверка запросов и ответов по openapi.json, nil в production
+	spec *specValidator
+	// метрики Prometheus, nil если они отдаются отдельным admin-листенером
+	metrics http.Handler
+	health  *health.Checker
+	// уровень логирования, меняется администратором без перезапуска
+	logLevel *slog.LevelVar
+	// разрешённые источники запросов из браузера, nil - CORS выключен
+	cors *CORS
+	// прокси, которым доверяется X-Forwarded-For при определении адреса клиента
+	trustedProxies []netip.Prefix
+	// закрывается при остановке сервера, потоки событий завершаются, клиенты переподключаются
+	streamsDone chan struct{}
+	stopStreams sync.Once
+}
+
+type HandlerOption func(h *Handler)
+
+// WithLoginGuard enables brute-force protection of login endpoint
+func WithLoginGuard(g LoginGuard) HandlerOption {
+	return func(h *Handler) {
+		h.guard = g
+	}
 }
 
-func NewHandler(store Store, poller Poller) *Handler {
-	return &Handler{store, poller}
+// WithCredsPolicy enables login and password checks on registration
+func WithCredsPolicy(p *policy.Policy) HandlerOption {
+	return func(h *Handler) {
+		h.policy = p
+	}
+}
+
+// WithBatchLimit sets maximum number of orders in batch upload
+func WithBatchLimit(n int) HandlerOption {
+	return func(h *Handler) {
+		h.batchLimit = n
+	}
+}
+
+// WithTrustedProxies makes client address be taken from X-Forwarded-For of requests from proxies
+func WithTrustedProxies(prefixes []netip.Prefix) HandlerOption {
+	return func(h *Handler) {
+		h.trustedProxies = prefixes
+	}
+}
+
+// WithMetrics serves Prometheus metrics at /metrics of the API listener
+func WithMetrics(m http.Handler) HandlerOption {
+	return func(h *Handler) {
+		h.metrics = m
+	}
+}
+
+const batchLimitDefault = 100
+
+func NewHandler(store Store, poller Poller, opts ...HandlerOption) *Handler {
+	h := &Handler{store: store, poller: poller, batchLimit: batchLimitDefault, streamsDone: make(chan struct{})}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h *Handler) NewOrder(w http.ResponseWriter, r *http.Request) {
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "unable to read body")
 		return
 	}
 	orderID, err := helpers.Atoi(data)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "body must be order number")
 		return
 	}
 	if !luhn.Valid(orderID) {
-		w.WriteHeader(http.StatusUnprocessableEntity)
+		writeError(w, r, http.StatusUnprocessableEntity, codeInvalidOrderNumber, "order number fails Luhn check")
 		return
 	}
 
 	userID := r.Context().Value(userIDCtxKey{}).(int)
-	var status OrderStatus
-	status, err = h.store.AddOrder(r.Context(), orderID, userID)
+	code, err := h.addOrder(r.Context(), orderID, userID, 0)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if code == http.StatusConflict {
+		writeError(w, r, code, codeOrderOwnedByOtherUser, "")
+		return
+	}
+	w.WriteHeader(code)
+}
+
+// addOrder saves order and pushes it to pollster, returns response status code
+func (h *Handler) addOrder(ctx context.Context, orderID int, userID int, merchantKeyID int) (int, error) {
+	trace.SpanFromContext(ctx).SetAttributes(tracing.AttrOrderID.Int(orderID))
+	status, err := h.store.AddOrder(ctx, orderID, userID, merchantKeyID)
 	if err != nil {
 		if errors.Is(err, model.ErrOldOrder) {
 			if status != model.OrderStatusProcessed && status != model.OrderStatusInvalid {
-				h.poller.Push(orderID)
+				h.poller.Push(ctx, orderID)
 			}
-			w.WriteHeader(http.StatusOK)
-			return
+			return http.StatusOK, nil
 		}
 		if errors.Is(err, model.ErrOrderExists) {
-			w.WriteHeader(http.StatusConflict)
-			return
+			return http.StatusConflict, nil
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return http.StatusInternalServerError, err
 	}
-	h.poller.Push(orderID)
-	w.WriteHeader(http.StatusAccepted)
+	h.poller.Push(ctx, orderID)
+	return http.StatusAccepted, nil
 }
 
+// OrderList returns all user orders as array. If any query parameter is given,
+// a page of orders is returned instead, see orderPage.
 func (h *Handler) OrderList(w http.ResponseWriter, r *http.Request) {
+	if len(r.URL.Query()) > 0 {
+		h.orderPage(w, r)
+		return
+	}
 	userID := r.Context().Value(userIDCtxKey{}).(int)
 	orders, err := h.store.ListOrders(r.Context(), userID)
-	slog.Debug(fmt.Sprintf("User %d orders: %+v", userID, orders))
+	slog.DebugContext(r.Context(), "orders listed", slog.Int("count", len(orders)))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
 	if len(orders) == 0 {
@@ -99,75 +227,145 @@ func (h *Handler) OrderList(w http.ResponseWriter, r *http.Request) {
 	}
 	resp, err := json.Marshal(orders)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(resp)
 }
 
+// orderPage supports parameters limit, cursor, status (repeated or comma separated) and from, to of uploaded_at
+func (h *Handler) orderPage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	params, err := parsePageParams(q)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	filter := model.OrderFilter{
+		Limit: params.limit + 1,
+		After: params.after,
+		From:  params.from,
+		To:    params.to,
+	}
+	for _, v := range multiParam(q, "status") {
+		var status OrderStatus
+		if err := status.UnmarshalText([]byte(strings.ToUpper(v))); err != nil {
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("unknown status %s", v))
+			return
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+	userID := r.Context().Value(userIDCtxKey{}).(int)
+	orders, err := h.store.ListOrdersPage(r.Context(), userID, filter)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	page := paginate(w, r, orders, params.limit, func(o Order) Cursor {
+		return Cursor{At: o.UploadedAt, ID: o.ID}
+	})
+	writeJSON(w, r, http.StatusOK, page)
+}
+
+// OrderDetail returns order of the user with its status history
+func (h *Handler) OrderDetail(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.PathValue("number"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidOrderNumber, "")
+		return
+	}
+	userID := r.Context().Value(userIDCtxKey{}).(int)
+	order, err := h.store.GetOrder(r.Context(), orderID)
+	// чужой заказ не отличаем от несуществующего
+	if errors.Is(err, model.ErrNoOrder) || (err == nil && order.UserID != userID) {
+		writeError(w, r, http.StatusNotFound, codeOrderNotFound, "")
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	history, err := h.store.GetOrderHistory(r.Context(), orderID)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, model.OrderDetail{Order: *order, History: history})
+}
+
 func (h *Handler) Balance(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(userIDCtxKey{}).(int)
 	account, err := h.store.GetBalance(r.Context(), userID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	resp, err := json.Marshal(&account)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
 	w.Write(resp)
 }
 
+// payDumpLog limits debug dumps of payment requests
+var payDumpLog = logging.NewSampler(10, time.Second)
+
 func (h *Handler) Pay(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
-	slog.Debug(string(body))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "unable to read body")
 		return
 	}
 	var payment Payment
 	err = json.Unmarshal(body, &payment)
-	slog.Debug(fmt.Sprintf("Payment: %+v", payment))
+	if ok, dropped := payDumpLog.Sample(r.Context(), slog.LevelDebug); ok {
+		slog.DebugContext(r.Context(), "payment request", slog.Any("body", logging.JSON(body)), slog.Int("sampled_out", dropped))
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "malformed JSON body")
 		return
 	}
 	if payment.OrderID == 0 {
-		w.WriteHeader(http.StatusUnprocessableEntity)
+		writeError(w, r, http.StatusUnprocessableEntity, codeInvalidOrderNumber, "order is required")
 		return
 	}
 	if payment.Sum == 0 {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidAmount, "sum is required")
 		return
 	}
 
 	if !luhn.Valid(payment.OrderID) {
-		w.WriteHeader(http.StatusUnprocessableEntity)
+		writeError(w, r, http.StatusUnprocessableEntity, codeInvalidOrderNumber, "order number fails Luhn check")
 		return
 	}
 	userID := r.Context().Value(userIDCtxKey{}).(int)
 	err = h.store.SpendBonus(r.Context(), userID, payment)
 	if err != nil {
 		if errors.Is(err, model.ErrNotEnough) {
-			http.Error(w, err.Error(), http.StatusPaymentRequired)
+			writeError(w, r, http.StatusPaymentRequired, codeInsufficientFunds, "")
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
+// PaymentList returns all user withdrawals as array. If any query parameter is given,
+// a page of withdrawals is returned instead, see paymentPage.
 func (h *Handler) PaymentList(w http.ResponseWriter, r *http.Request) {
+	if len(r.URL.Query()) > 0 {
+		h.paymentPage(w, r)
+		return
+	}
 	userID := r.Context().Value(userIDCtxKey{}).(int)
 	payments, err := h.store.SpentBonusList(r.Context(), userID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
 	if len(payments) == 0 {
@@ -176,9 +374,78 @@ func (h *Handler) PaymentList(w http.ResponseWriter, r *http.Request) {
 	}
 	resp, err := json.Marshal(payments)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(resp)
 }
+
+type paymentPage struct {
+	Page[PaymentFact]
+	Summary *model.WithdrawalSummary `json:"summary,omitempty"`
+}
+
+// paymentPage supports parameters limit, cursor, from, to of processed_at and summary=true,
+// which adds count and total of withdrawals in the range
+func (h *Handler) paymentPage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	params, err := parsePageParams(q)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	var withSummary bool
+	if v := q.Get("summary"); v != "" {
+		if withSummary, err = strconv.ParseBool(v); err != nil {
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid summary")
+			return
+		}
+	}
+	filter := model.PaymentFilter{
+		Limit: params.limit + 1,
+		After: params.after,
+		From:  params.from,
+		To:    params.to,
+	}
+	userID := r.Context().Value(userIDCtxKey{}).(int)
+	payments, err := h.store.SpentBonusPage(r.Context(), userID, filter)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	resp := paymentPage{
+		Page: paginate(w, r, payments, params.limit, func(p PaymentFact) Cursor {
+			return Cursor{At: p.ProcessedAt, ID: p.OrderID}
+		}),
+	}
+	if withSummary {
+		summary, err := h.store.SpentBonusSummary(r.Context(), userID, params.from, params.to)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+		resp.Summary = &summary
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// Adjustments lists manual balance changes made by support staff
+func (h *Handler) Adjustments(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(userIDCtxKey{}).(int)
+	adjustments, err := h.store.ListAdjustments(r.Context(), userID)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if len(adjustments) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	for i := range adjustments {
+		// пользователю не показываем, кто из сотрудников сделал корректировку
+		adjustments[i].AdminID = 0
+		adjustments[i].Force = false
+	}
+	writeJSON(w, r, http.StatusOK, adjustments)
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -95,9 +96,9 @@ func TestHandler_NewOrder(t *testing.T) {
 				orderID = -1
 			}
 
-			m.EXPECT().AddOrder(ctx, orderID, userID).Return(model.OrderStatusNew, tt.mockErr).Times(1)
+			m.EXPECT().AddOrder(ctx, orderID, userID, 0).Return(model.OrderStatusNew, tt.mockErr).Times(1)
 
-			h.poller.(*MockPoller).EXPECT().Push(orderID).Times(1)
+			h.poller.(*MockPoller).EXPECT().Push(ctx, orderID).Times(1)
 
 			h.NewOrder(w, req)
 
@@ -165,7 +166,7 @@ func TestHandler_OrderList(t *testing.T) {
 			name: "order_list_status_code_500",
 			want: want{
 				statusCode:  http.StatusInternalServerError,
-				contentType: "text/plain; charset=utf-8",
+				contentType: problemContentType,
 			},
 			mockErr: errors.New("any unexpected error"),
 		},
@@ -209,6 +210,14 @@ func TestHandler_OrderList(t *testing.T) {
 			}
 
 			if result.StatusCode == http.StatusInternalServerError {
+				var p Problem
+				if err := json.Unmarshal(resBody, &p); err != nil {
+					t.Fatal(err)
+				}
+				// подробности внутренней ошибки не отдаются клиенту
+				if p.Code != codeInternal || strings.Contains(string(resBody), tt.mockErr.Error()) {
+					t.Errorf("unexpected problem %s", resBody)
+				}
 				return
 			}
 
@@ -446,8 +455,29 @@ func TestHandler_Pay(t *testing.T) {
 			want: want{
 				statusCode: http.StatusInternalServerError,
 			},
+			reqBody: `{
+				"order": "2377225624",
+				"sum": 751
+			}`,
+			mockPayment: Payment{
+				OrderID: 2377225624,
+				Sum:     751,
+			},
 			mockErr: errors.New("internal server error"),
 		},
+		{
+			name: "malformed_json",
+			want: want{
+				statusCode: http.StatusBadRequest,
+			},
+			reqBody: `{"order": "2377225624", "sum":`,
+		},
+		{
+			name: "empty_body",
+			want: want{
+				statusCode: http.StatusBadRequest,
+			},
+		},
 		{
 			name: "not_enough_funds",
 			reqBody: `{
@@ -506,3 +536,303 @@ func TestHandler_Pay(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_OrderPage(t *testing.T) {
+	userID := 77
+	at := time.Date(2020, 12, 10, 15, 15, 45, 0, time.UTC)
+	orders := []Order{
+		{ID: 9278923470, Status: model.OrderStatusProcessed, UploadedAt: at},
+		{ID: 12345678903, Status: model.OrderStatusNew, UploadedAt: at.Add(-time.Hour)},
+		{ID: 346436439, Status: model.OrderStatusNew, UploadedAt: at.Add(-2 * time.Hour)},
+	}
+	cursor := encodeCursor(Cursor{At: at, ID: 9278923470})
+
+	tests := []struct {
+		name       string
+		query      string
+		wantFilter model.OrderFilter
+		mockOrders []Order
+		statusCode int
+		wantItems  int
+		wantNext   bool
+	}{
+		{
+			name:  "first_page",
+			query: "?limit=2&status=processed,NEW",
+			wantFilter: model.OrderFilter{
+				Limit:    3,
+				Statuses: []OrderStatus{model.OrderStatusProcessed, model.OrderStatusNew},
+			},
+			mockOrders: orders,
+			statusCode: http.StatusOK,
+			wantItems:  2,
+			wantNext:   true,
+		},
+		{
+			name:  "last_page",
+			query: "?limit=2&cursor=" + cursor + "&from=2020-12-10T00:00:00Z",
+			wantFilter: model.OrderFilter{
+				Limit: 3,
+				After: &Cursor{At: at, ID: 9278923470},
+				From:  time.Date(2020, 12, 10, 0, 0, 0, 0, time.UTC),
+			},
+			mockOrders: orders[1:],
+			statusCode: http.StatusOK,
+			wantItems:  2,
+		},
+		{
+			name:       "invalid_limit",
+			query:      "?limit=0",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid_cursor",
+			query:      "?cursor=not-a-cursor",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid_status",
+			query:      "?status=LOST",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := setupHandler(t)
+			req := httptest.NewRequest(http.MethodGet, "/api/user/orders"+tt.query, nil)
+			ctx := context.WithValue(req.Context(), userIDCtxKey{}, userID)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+
+			if tt.statusCode == http.StatusOK {
+				m := h.store.(*mock.MockStore)
+				m.EXPECT().ListOrdersPage(ctx, userID, tt.wantFilter).Return(tt.mockOrders, nil)
+			}
+
+			h.OrderList(w, req)
+
+			if w.Code != tt.statusCode {
+				t.Fatalf("got status %v, want %v", w.Code, tt.statusCode)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var page Page[Order]
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Items) != tt.wantItems {
+				t.Errorf("got %d items, want %d", len(page.Items), tt.wantItems)
+			}
+			if (page.NextCursor != "") != tt.wantNext || (w.Header().Get("Link") != "") != tt.wantNext {
+				t.Errorf("got next cursor %q and Link %q", page.NextCursor, w.Header().Get("Link"))
+			}
+			if tt.wantNext {
+				next, err := decodeCursor(page.NextCursor)
+				if err != nil {
+					t.Fatal(err)
+				}
+				last := page.Items[len(page.Items)-1]
+				if !next.At.Equal(last.UploadedAt) || next.ID != last.ID {
+					t.Errorf("next cursor %+v doesn't point to last item %+v", next, last)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_PaymentPage(t *testing.T) {
+	userID := 77
+	at := time.Date(2020, 12, 9, 16, 9, 57, 0, time.UTC)
+	payments := []PaymentFact{
+		{Payment: Payment{OrderID: 2377225624, Sum: 500}, ProcessedAt: at},
+		{Payment: Payment{OrderID: 9278923470, Sum: 100}, ProcessedAt: at.Add(-time.Hour)},
+	}
+	from := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h := setupHandler(t)
+	req := httptest.NewRequest(http.MethodGet, "/api/user/withdrawals?limit=1&summary=true&from=2020-12-01T00:00:00Z&to=2021-01-01T00:00:00Z", nil)
+	ctx := context.WithValue(req.Context(), userIDCtxKey{}, userID)
+	req = req.WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	m := h.store.(*mock.MockStore)
+	m.EXPECT().SpentBonusPage(ctx, userID, model.PaymentFilter{Limit: 2, From: from, To: to}).Return(payments, nil)
+	m.EXPECT().SpentBonusSummary(ctx, userID, from, to).Return(model.WithdrawalSummary{Count: 2, Total: 600}, nil)
+
+	h.PaymentList(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %v, want %v", w.Code, http.StatusOK)
+	}
+	var got struct {
+		Page[PaymentFact]
+		Summary *model.WithdrawalSummary `json:"summary"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(payments[:1], got.Items); diff != "" {
+		t.Errorf("Items mismatch (-want +got):\n%s", diff)
+	}
+	if got.NextCursor != encodeCursor(Cursor{At: at, ID: 2377225624}) {
+		t.Errorf("unexpected next cursor %q", got.NextCursor)
+	}
+	if got.Summary == nil || got.Summary.Count != 2 || got.Summary.Total != 600 {
+		t.Errorf("unexpected summary %+v", got.Summary)
+	}
+}
+
+func TestHandler_OrderDetail(t *testing.T) {
+	userID := 77
+	accrual := 500.0
+	at := time.Date(2020, 12, 10, 15, 15, 45, 0, time.UTC)
+	history := []model.OrderStatusEvent{
+		{Status: model.OrderStatusRegistered, SeenAt: at.Add(time.Second)},
+		{Status: model.OrderStatusProcessed, Accrual: &accrual, SeenAt: at.Add(3 * time.Second)},
+	}
+	tests := []struct {
+		name       string
+		mockOrder  *Order
+		mockErr    error
+		statusCode int
+	}{
+		{
+			name:       "own_order",
+			mockOrder:  &Order{UserID: userID, ID: 9278923470, Status: model.OrderStatusProcessed, Accrual: &accrual, UploadedAt: at},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "order_of_other_user",
+			mockOrder:  &Order{UserID: 78, ID: 9278923470, Status: model.OrderStatusProcessed, UploadedAt: at},
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "unknown_order",
+			mockOrder:  &Order{ID: 9278923470},
+			mockErr:    model.ErrNoOrder,
+			statusCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := setupHandler(t)
+			req := httptest.NewRequest(http.MethodGet, "/api/user/orders/9278923470", nil)
+			req.SetPathValue("number", "9278923470")
+			ctx := context.WithValue(req.Context(), userIDCtxKey{}, userID)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+
+			m := h.store.(*mock.MockStore)
+			m.EXPECT().GetOrder(ctx, 9278923470).Return(tt.mockOrder, tt.mockErr)
+			if tt.statusCode == http.StatusOK {
+				m.EXPECT().GetOrderHistory(ctx, 9278923470).Return(history, nil)
+			}
+
+			h.OrderDetail(w, req)
+
+			if w.Code != tt.statusCode {
+				t.Fatalf("got status %v, want %v", w.Code, tt.statusCode)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var got model.OrderDetail
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(history, got.History); diff != "" {
+				t.Errorf("History mismatch (-want +got):\n%s", diff)
+			}
+			if got.ID != 9278923470 {
+				t.Errorf("got order %d, want %d", got.ID, 9278923470)
+			}
+		})
+	}
+}
+
+func TestHandler_NewOrderBatch(t *testing.T) {
+	userID := 77
+	h := setupHandler(t)
+	h.batchLimit = 10
+	body := `["7992723465", 12345678903, "12121", "12a", "346436439", "7992723465", "9278923470"]`
+	req := httptest.NewRequest(http.MethodPost, "/api/user/orders/batch", bytes.NewBufferString(body))
+	ctx := context.WithValue(req.Context(), userIDCtxKey{}, userID)
+	req = req.WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	m := h.store.(*mock.MockStore)
+	m.EXPECT().AddOrders(ctx, []int{7992723465, 12345678903, 346436439, 9278923470}, userID).Return([]model.OrderUpload{
+		{ID: 7992723465, Result: model.UploadAccepted},
+		{ID: 12345678903, Result: model.UploadAlreadyUploaded, Status: model.OrderStatusProcessing},
+		{ID: 346436439, Result: model.UploadAlreadyUploaded, Status: model.OrderStatusProcessed},
+		{ID: 9278923470, Result: model.UploadOwnedByOther},
+	}, nil)
+	h.poller.(*MockPoller).EXPECT().PushBatch(ctx, []int{7992723465, 12345678903})
+
+	h.NewOrderBatch(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %v, want %v", w.Code, http.StatusOK)
+	}
+	var got []OrderUpload
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []OrderUpload{
+		{Number: "7992723465", Result: model.UploadAccepted},
+		{Number: "12345678903", Result: model.UploadAlreadyUploaded},
+		{Number: "12121", Result: model.UploadInvalidNumber},
+		{Number: "12a", Result: model.UploadMalformed},
+		{Number: "346436439", Result: model.UploadAlreadyUploaded},
+		{Number: "7992723465", Result: model.UploadAlreadyUploaded},
+		{Number: "9278923470", Result: model.UploadOwnedByOther},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Body mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandler_NewOrderBatchTooLarge(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "too_many_items", body: `["7992723465", "12345678903", "346436439"]`},
+		// массив не дочитывается до конца
+		{name: "unterminated", body: `["7992723465", "12345678903", "346436439", "9278923470"`},
+		{name: "huge_item", body: `["` + strings.Repeat("1", 10*batchItemMaxSize) + `"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := setupHandler(t)
+			h.batchLimit = 2
+			req := httptest.NewRequest(http.MethodPost, "/api/user/orders/batch", bytes.NewBufferString(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), userIDCtxKey{}, 77))
+			w := httptest.NewRecorder()
+
+			h.NewOrderBatch(w, req)
+
+			if w.Code != http.StatusRequestEntityTooLarge {
+				t.Errorf("got status %v, want %v", w.Code, http.StatusRequestEntityTooLarge)
+			}
+		})
+	}
+}
+
+func TestHandler_NewOrderBatchMalformed(t *testing.T) {
+	for _, body := range []string{`{"order": "7992723465"}`, `["7992723465"`, `[]`, `null`} {
+		h := setupHandler(t)
+		h.batchLimit = 10
+		req := httptest.NewRequest(http.MethodPost, "/api/user/orders/batch", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), userIDCtxKey{}, 77))
+		w := httptest.NewRecorder()
+
+		h.NewOrderBatch(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %v, want %v", body, w.Code, http.StatusBadRequest)
+		}
+	}
+}
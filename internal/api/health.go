@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+
+	"gophermart/internal/health"
+)
+
+// WithHealth enables readiness checks of dependencies at /readyz
+func WithHealth(c *health.Checker) HandlerOption {
+	return func(h *Handler) {
+		h.health = c
+	}
+}
+
+// Healthz is liveness probe, it only shows that process serves HTTP
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, health.Report{Status: health.StatusOK})
+}
+
+// Readyz is readiness probe, degraded dependencies don't take instance out of balancing
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	if h.health == nil {
+		writeJSON(w, r, http.StatusOK, health.Report{Status: health.StatusOK})
+		return
+	}
+	report := h.health.Check(r.Context())
+	code := http.StatusOK
+	if !report.Ready() {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, r, code, report)
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gophermart/internal/health"
+)
+
+func TestHandler_Readyz(t *testing.T) {
+	checker := health.New(time.Second)
+	checker.Add("postgres", func(context.Context) error { return nil })
+	checker.AddDegraded("accrual", func(context.Context) error { return errors.New("accrual system refuses connections") })
+	router := Router(NewHandler(nil, nil, WithHealth(checker), WithSpecValidation(true)))
+
+	probe := func(path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+	if code := probe("/readyz"); code != http.StatusOK {
+		t.Errorf("degraded instance must stay ready, got status %v", code)
+	}
+	checker.Drain()
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("draining instance must not be ready, got status %v", code)
+	}
+	if code := probe("/healthz"); code != http.StatusOK {
+		t.Errorf("got liveness status %v, want %v", code, http.StatusOK)
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"gophermart/internal/logging"
+)
+
+// WithLogLevel allows administrators to change level of logger at runtime
+func WithLogLevel(lvl *slog.LevelVar) HandlerOption {
+	return func(h *Handler) {
+		h.logLevel = lvl
+	}
+}
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+func (h *Handler) AdminLogLevel(w http.ResponseWriter, r *http.Request) {
+	if h.logLevel == nil {
+		writeError(w, r, http.StatusNotImplemented, codeNotImplemented, "log level is not managed by this instance")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, logLevel{Level: logging.LevelName(h.logLevel.Level())})
+}
+
+// AdminSetLogLevel changes level of this instance only, it's reset on restart
+func (h *Handler) AdminSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	if h.logLevel == nil {
+		writeError(w, r, http.StatusNotImplemented, codeNotImplemented, "log level is not managed by this instance")
+		return
+	}
+	var req logLevel
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "malformed JSON body")
+		return
+	}
+	level, err := logging.ParseLevel(req.Level)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	// смена уровня не завершается ошибкой, поэтому аудит пишется до неё
+	if !h.audit(w, r, "set_log_level", "level:"+logging.LevelName(level), "was "+logging.LevelName(h.logLevel.Level())) {
+		return
+	}
+	h.logLevel.Set(level)
+	slog.InfoContext(r.Context(), "log level changed", slog.String("level", logging.LevelName(level)))
+	writeJSON(w, r, http.StatusOK, logLevel{Level: logging.LevelName(level)})
+}
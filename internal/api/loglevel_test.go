@@ -0,0 +1,73 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gophermart/internal/mock"
+	"gophermart/internal/model"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+func TestAdmin_LogLevel(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		reqBody    string
+		audit      bool
+		statusCode int
+		level      slog.Level
+	}{
+		{
+			name:       "get",
+			method:     http.MethodGet,
+			statusCode: http.StatusOK,
+			level:      slog.LevelInfo,
+		},
+		{
+			name:       "set_warn",
+			method:     http.MethodPut,
+			reqBody:    `{"level": "warn"}`,
+			audit:      true,
+			statusCode: http.StatusOK,
+			level:      slog.LevelWarn,
+		},
+		{
+			name:       "unknown_level",
+			method:     http.MethodPut,
+			reqBody:    `{"level": "verbose"}`,
+			statusCode: http.StatusBadRequest,
+			level:      slog.LevelInfo,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lvl := new(slog.LevelVar)
+			h := setupHandler(t)
+			WithLogLevel(lvl)(h)
+			WithSpecValidation(true)(h)
+			m := h.store.(*mock.MockStore)
+			m.EXPECT().UserAccess(gomock.Any(), 1).Return(false, model.RoleAdmin, nil)
+			if tt.audit {
+				m.EXPECT().AddAudit(gomock.Any(), gomock.Any()).Return(nil)
+			}
+
+			req := adminRequestWithBody(t, tt.method, "/api/admin/log-level", tt.reqBody, 1, model.RoleAdmin)
+			if tt.reqBody != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+			Router(h).ServeHTTP(w, req)
+
+			if w.Code != tt.statusCode {
+				t.Errorf("got status %v, want %v: %s", w.Code, tt.statusCode, w.Body)
+			}
+			if lvl.Level() != tt.level {
+				t.Errorf("got level %v, want %v", lvl.Level(), tt.level)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gophermart/internal/logging"
+	"gophermart/internal/model"
+
+	"github.com/theplant/luhn"
+)
+
+const merchantKeyPrefix = "gm_"
+
+type merchantCtxKey struct{}
+
+// MerchantOrder is a request of storefront backend to attach order to user account
+type MerchantOrder struct {
+	Login   string `json:"login"`
+	OrderID int    `json:"order,string"`
+}
+
+func newMerchantKey() (key string, hash []byte, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	key = merchantKeyPrefix + hex.EncodeToString(b)
+	return key, hashMerchantKey(key), nil
+}
+
+// hashMerchantKey doesn't need salt or slow hash, keys are random 256 bit values
+func hashMerchantKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// merchantMiddleware authenticates storefront backend by X-API-Key header
+func (h *Handler) merchantMiddleware(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey := r.Header.Get("X-API-Key")
+			if apiKey == "" {
+				writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "X-API-Key header is required")
+				return
+			}
+			key, err := h.store.GetMerchantKey(r.Context(), hashMerchantKey(apiKey))
+			if errors.Is(err, model.ErrNoMerchantKey) {
+				writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "unknown or revoked API key")
+				return
+			}
+			if err != nil {
+				internalError(w, r, err)
+				return
+			}
+			if !key.HasScope(scope) {
+				writeError(w, r, http.StatusForbidden, codeForbidden, fmt.Sprintf("API key has no %s scope", scope))
+				return
+			}
+			ctx := context.WithValue(r.Context(), merchantCtxKey{}, key)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// MerchantNewOrder attaches order to account of user with given login.
+// Status codes are the same as of NewOrder.
+func (h *Handler) MerchantNewOrder(w http.ResponseWriter, r *http.Request) {
+	var req MerchantOrder
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "malformed JSON body")
+		return
+	}
+	if req.Login == "" || req.OrderID <= 0 {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "empty login or order")
+		return
+	}
+	if !luhn.Valid(req.OrderID) {
+		writeError(w, r, http.StatusUnprocessableEntity, codeInvalidOrderNumber, "order number fails Luhn check")
+		return
+	}
+	user, err := h.store.GetUser(r.Context(), req.Login)
+	if errors.Is(err, model.ErrUserNotFound) {
+		writeError(w, r, http.StatusNotFound, codeUserNotFound, "")
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if user.Blocked {
+		writeError(w, r, http.StatusForbidden, codeUserBlocked, "")
+		return
+	}
+	// запрос делает мерчант, но опрос заказа логируется от имени пользователя
+	r = r.WithContext(logging.WithUserID(r.Context(), user.ID))
+	// мерчант получает события только созданных им заказов, ранее загруженные остаются за пользователем
+	key := r.Context().Value(merchantCtxKey{}).(*MerchantKey)
+	code, err := h.addOrder(r.Context(), req.OrderID, user.ID, key.ID)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if code == http.StatusConflict {
+		writeError(w, r, code, codeOrderOwnedByOtherUser, "")
+		return
+	}
+	w.WriteHeader(code)
+}
+
+func (h *Handler) AdminCreateMerchantKey(w http.ResponseWriter, r *http.Request) {
+	var key MerchantKey
+	if err := json.NewDecoder(r.Body).Decode(&key); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "malformed JSON body")
+		return
+	}
+	if key.Name == "" || len(key.Scopes) == 0 {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "name and scopes are required")
+		return
+	}
+	for _, scope := range key.Scopes {
+		if scope != model.ScopeOrdersWrite && scope != model.ScopeWebhooks {
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("unknown scope %s", scope))
+			return
+		}
+	}
+	var err error
+	key.Key, key.Hash, err = newMerchantKey()
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	key.CreatedBy = r.Context().Value(userIDCtxKey{}).(int)
+	key.CreatedAt = time.Now()
+	rec := auditRecord(r, "create_merchant_key", "merchant:"+key.Name, "scopes:"+strings.Join(key.Scopes, ","))
+	key.ID, err = h.store.AddMerchantKey(r.Context(), key, rec)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, key)
+}
+
+func (h *Handler) AdminMerchantKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.store.ListMerchantKeys(r.Context())
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if !h.audit(w, r, "view_merchant_keys", "merchant_keys", fmt.Sprintf("%d keys", len(keys))) {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, keys)
+}
+
+func (h *Handler) AdminRevokeMerchantKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid key id")
+		return
+	}
+	rec := auditRecord(r, "revoke_merchant_key", fmt.Sprintf("merchant_key:%d", id), "revoked")
+	err = h.store.RevokeMerchantKey(r.Context(), id, rec)
+	if errors.Is(err, model.ErrNoMerchantKey) {
+		writeError(w, r, http.StatusNotFound, codeMerchantKeyNotFound, "")
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
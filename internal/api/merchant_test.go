@@ -0,0 +1,160 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gophermart/internal/mock"
+	"gophermart/internal/model"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+func TestHandler_MerchantNewOrder(t *testing.T) {
+	apiKey := "gm_0123456789abcdef"
+	tests := []struct {
+		name       string
+		apiKey     string
+		scopes     []string
+		reqBody    string
+		setup      func(m *mock.MockStore, p *MockPoller)
+		statusCode int
+	}{
+		{
+			name:       "no_api_key",
+			reqBody:    `{"login": "user", "order": "7992723465"}`,
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing_scope",
+			apiKey:     apiKey,
+			reqBody:    `{"login": "user", "order": "7992723465"}`,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:    "accepted",
+			apiKey:  apiKey,
+			scopes:  []string{model.ScopeOrdersWrite},
+			reqBody: `{"login": "user", "order": "7992723465"}`,
+			setup: func(m *mock.MockStore, p *MockPoller) {
+				m.EXPECT().GetUser(gomock.Any(), "user").Return(&User{ID: 7, Login: "user"}, nil)
+				m.EXPECT().AddOrder(gomock.Any(), 7992723465, 7, 1).Return(model.OrderStatusNew, nil)
+				p.EXPECT().Push(gomock.Any(), 7992723465)
+			},
+			statusCode: http.StatusAccepted,
+		},
+		{
+			// заказ остаётся без мерчанта, его события не уходят вебхукам мерчанта
+			name:    "uploaded_by_user_before",
+			apiKey:  apiKey,
+			scopes:  []string{model.ScopeOrdersWrite},
+			reqBody: `{"login": "user", "order": "7992723465"}`,
+			setup: func(m *mock.MockStore, _ *MockPoller) {
+				m.EXPECT().GetUser(gomock.Any(), "user").Return(&User{ID: 7, Login: "user"}, nil)
+				m.EXPECT().AddOrder(gomock.Any(), 7992723465, 7, 1).Return(model.OrderStatusProcessed, model.ErrOldOrder)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:    "owned_by_other_user",
+			apiKey:  apiKey,
+			scopes:  []string{model.ScopeOrdersWrite},
+			reqBody: `{"login": "user", "order": "7992723465"}`,
+			setup: func(m *mock.MockStore, _ *MockPoller) {
+				m.EXPECT().GetUser(gomock.Any(), "user").Return(&User{ID: 7, Login: "user"}, nil)
+				m.EXPECT().AddOrder(gomock.Any(), 7992723465, 7, 1).Return(model.OrderStatus(-1), model.ErrOrderExists)
+			},
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:    "unknown_user",
+			apiKey:  apiKey,
+			scopes:  []string{model.ScopeOrdersWrite},
+			reqBody: `{"login": "nobody", "order": "7992723465"}`,
+			setup: func(m *mock.MockStore, _ *MockPoller) {
+				m.EXPECT().GetUser(gomock.Any(), "nobody").Return(&User{}, model.ErrUserNotFound)
+			},
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:    "store_error",
+			apiKey:  apiKey,
+			scopes:  []string{model.ScopeOrdersWrite},
+			reqBody: `{"login": "user", "order": "7992723465"}`,
+			setup: func(m *mock.MockStore, _ *MockPoller) {
+				m.EXPECT().GetUser(gomock.Any(), "user").Return(nil, errors.New("connection refused"))
+			},
+			statusCode: http.StatusInternalServerError,
+		},
+		{
+			name:       "luhn_invalid",
+			apiKey:     apiKey,
+			scopes:     []string{model.ScopeOrdersWrite},
+			reqBody:    `{"login": "user", "order": "12121"}`,
+			statusCode: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := setupHandler(t)
+			m := h.store.(*mock.MockStore)
+			if tt.apiKey != "" {
+				m.EXPECT().GetMerchantKey(gomock.Any(), hashMerchantKey(tt.apiKey)).Return(&MerchantKey{ID: 1, Scopes: tt.scopes}, nil)
+			}
+			if tt.setup != nil {
+				tt.setup(m, h.poller.(*MockPoller))
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/merchant/orders", bytes.NewBufferString(tt.reqBody))
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			w := httptest.NewRecorder()
+
+			Router(h).ServeHTTP(w, req)
+
+			if w.Code != tt.statusCode {
+				t.Errorf("got status %v, want %v", w.Code, tt.statusCode)
+			}
+		})
+	}
+}
+
+func TestHandler_AdminCreateMerchantKey(t *testing.T) {
+	h := setupHandler(t)
+	m := h.store.(*mock.MockStore)
+	m.EXPECT().UserAccess(gomock.Any(), 1).Return(false, model.RoleAdmin, nil)
+	var stored MerchantKey
+	m.EXPECT().AddMerchantKey(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, key MerchantKey, rec AuditRecord) (int, error) {
+		if rec.Action != "create_merchant_key" || rec.Target != "merchant:shop" {
+			t.Errorf("unexpected audit record %+v", rec)
+		}
+		stored = key
+		return 5, nil
+	})
+
+	w := httptest.NewRecorder()
+	req := adminRequestWithBody(t, http.MethodPost, "/api/admin/merchant-keys", `{"name": "shop", "scopes": ["orders:write"]}`, 1, model.RoleAdmin)
+	Router(h).ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got status %v, want %v", w.Code, http.StatusCreated)
+	}
+	var got MerchantKey
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 5 || !strings.HasPrefix(got.Key, merchantKeyPrefix) {
+		t.Errorf("unexpected key in response %+v", got)
+	}
+	if !bytes.Equal(stored.Hash, hashMerchantKey(got.Key)) {
+		t.Error("stored hash doesn't match returned key")
+	}
+	if strings.Contains(w.Body.String(), "hash") {
+		t.Error("key hash must not be returned")
+	}
+}
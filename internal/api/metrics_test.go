@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gophermart/internal/metrics"
+)
+
+func TestRouter_Metrics(t *testing.T) {
+	h := NewHandler(nil, nil, WithMetrics(metrics.Default.Handler()))
+	router := Router(h)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %v, want %v", w.Code, http.StatusOK)
+	}
+	// маршрут берётся из шаблона, а не из пути запроса
+	want := `gophermart_http_requests_total{route="GET /api/openapi.json",status="200"}`
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("metrics do not contain %s:\n%s", want, w.Body)
+	}
+}
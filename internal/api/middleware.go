@@ -4,29 +4,51 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 
+	"gophermart/internal/logging"
+	"gophermart/internal/metrics"
+	"gophermart/internal/model"
+	"gophermart/internal/tracing"
+
 	"github.com/felixge/httpsnoop"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID limits incoming X-Request-ID, it's written to logs and response as is
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// loggingMiddleware accepts X-Request-ID of client or proxy, otherwise generates it
 func loggingMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		reqID := uuid.New().String()
-		slog.Info(
+		reqID := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(reqID) {
+			reqID = uuid.New().String()
+		}
+		w.Header().Set(requestIDHeader, reqID)
+		ctx := logging.WithRequestID(r.Context(), reqID)
+		r = r.WithContext(ctx)
+		slog.InfoContext(ctx,
 			"REQ",
-			slog.String("request_id", reqID),
 			slog.String("method", r.Method),
-			slog.String("uri", r.URL.String()),
+			slog.Any("uri", logging.URL(r.URL)),
 			slog.String("ip", r.RemoteAddr),
 			slog.String("user_agent", r.Header.Get("User-Agent")),
 		)
 
 		// this runs handler h and captures information about HTTP request
 		m := httpsnoop.CaptureMetrics(h, w, r)
-		slog.Info(
+		slog.InfoContext(ctx,
 			"RES",
-			slog.String("request_id", reqID),
 			slog.Int("status", m.Code),
 			slog.Duration("duration", m.Duration),
 			slog.Int64("size", m.Written),
@@ -34,24 +56,110 @@ func loggingMiddleware(h http.Handler) http.Handler {
 	})
 }
 
+var (
+	httpRequests = metrics.NewCounterVec("gophermart_http_requests_total",
+		"HTTP requests by route pattern and status code.", "route", "status")
+	httpDuration = metrics.NewHistogramVec("gophermart_http_request_duration_seconds",
+		"HTTP request latency by route pattern and status code.", metrics.DefBuckets, "route", "status")
+)
+
+type routeMatcher interface {
+	Handler(r *http.Request) (h http.Handler, pattern string)
+}
+
+// metricsMiddleware labels requests with route pattern instead of path, so order numbers don't blow up cardinality
+func metricsMiddleware(mux routeMatcher) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, route := mux.Handler(r)
+			m := httpsnoop.CaptureMetrics(next, w, r)
+			status := strconv.Itoa(m.Code)
+			httpRequests.Inc(route, status)
+			httpDuration.Observe(m.Duration.Seconds(), route, status)
+		})
+	}
+}
+
+// tracingMiddleware starts server span named by route pattern, continuing trace from incoming traceparent
+func tracingMiddleware(mux routeMatcher) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, route := mux.Handler(r)
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracing.Tracer().Start(ctx, route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("http.route", route),
+					attribute.String("gophermart.request_id", requestID(ctx)),
+				))
+			defer span.End()
+			m := httpsnoop.CaptureMetrics(next, w, r.WithContext(ctx))
+			span.SetAttributes(attribute.Int("http.response.status_code", m.Code))
+			if m.Code >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(m.Code))
+			}
+		})
+	}
+}
+
+func requestID(ctx context.Context) string {
+	return logging.FromContext(ctx).RequestID
+}
+
 type userIDCtxKey struct{}
+type roleCtxKey struct{}
 
 func authMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		auth := r.Header.Get("Authorization")
 		if auth == "" {
-			w.WriteHeader(http.StatusUnauthorized)
+			writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Authorization header is required")
 			return
 		}
 		auth = strings.Replace(auth, "Bearer ", "", 1)
-		userID, err := getUserID(auth)
+		claims, err := parseClaims(auth)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+			writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "invalid or expired token")
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), userIDCtxKey{}, *userID)
+		ctx := context.WithValue(r.Context(), userIDCtxKey{}, claims.UserID)
+		ctx = logging.WithUserID(ctx, claims.UserID)
+		// роль из токена - только подсказка, activeUserMiddleware заменяет её ролью из базы
+		ctx = context.WithValue(ctx, roleCtxKey{}, claims.Role)
 		r = r.WithContext(ctx)
 		h.ServeHTTP(w, r)
 	})
 }
+
+// activeUserMiddleware rejects requests of blocked users, their tokens may be still valid.
+// It puts role of user from database into context, so revoked role doesn't live until token expiry.
+func (h *Handler) activeUserMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value(userIDCtxKey{}).(int)
+		blocked, role, err := h.store.UserAccess(r.Context(), userID)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+		if blocked {
+			writeError(w, r, http.StatusForbidden, codeUserBlocked, "")
+			return
+		}
+		ctx := context.WithValue(r.Context(), roleCtxKey{}, role)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// adminMiddleware must be used after activeUserMiddleware
+func adminMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, _ := r.Context().Value(roleCtxKey{}).(model.Role)
+		if role != model.RoleAdmin {
+			writeError(w, r, http.StatusForbidden, codeForbidden, "admin role is required")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
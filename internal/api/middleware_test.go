@@ -0,0 +1,111 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gophermart/internal/logging"
+	"gophermart/internal/mock"
+	"gophermart/internal/model"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+func TestLoggingMiddleware_RequestID(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(logging.NewHandler(slog.NewTextHandler(&logs, nil))))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	tests := []struct {
+		name     string
+		incoming string
+		generate bool
+	}{
+		{name: "incoming_id_is_kept", incoming: "edge-7f3a.42"},
+		{name: "missing_id_is_generated", generate: true},
+		{name: "unsafe_id_is_replaced", incoming: "bad id\nINFO forged", generate: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			h := setupHandler(t)
+			m := h.store.(*mock.MockStore)
+			m.EXPECT().UserAccess(gomock.Any(), 7).Return(false, model.RoleUser, nil)
+			m.EXPECT().GetBalance(gomock.Any(), 7).Return(nil, errors.New("connection reset"))
+
+			req := adminRequest(t, http.MethodGet, "/api/user/balance", 7, model.RoleUser)
+			if tt.incoming != "" {
+				req.Header.Set(requestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			Router(h).ServeHTTP(w, req)
+
+			reqID := w.Header().Get(requestIDHeader)
+			if tt.generate && (reqID == "" || reqID == tt.incoming) {
+				t.Fatalf("got request id %q, want generated one", reqID)
+			}
+			if !tt.generate && reqID != tt.incoming {
+				t.Fatalf("got request id %q, want %q", reqID, tt.incoming)
+			}
+			var p Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if p.RequestID != reqID {
+				t.Errorf("got request id %q in problem, want %q", p.RequestID, reqID)
+			}
+			// строка лога обработчика должна быть связана с запросом и пользователем
+			var found bool
+			for _, line := range strings.Split(logs.String(), "\n") {
+				if strings.Contains(line, "internal error") {
+					found = strings.Contains(line, "request_id="+reqID) && strings.Contains(line, "user_id=7")
+				}
+			}
+			if !found {
+				t.Errorf("handler log has no request_id and user_id:\n%s", logs.String())
+			}
+		})
+	}
+}
+
+func TestLogging_Redaction(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	redactor, err := logging.NewRedactor(logging.DefaultRedactKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: redactor.ReplaceAttr}
+	slog.SetDefault(slog.New(logging.NewHandler(slog.NewJSONHandler(&logs, opts))))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	h := setupHandler(t)
+	m := h.store.(*mock.MockStore)
+	m.EXPECT().UserAccess(gomock.Any(), 7).Return(false, model.RoleUser, nil)
+	m.EXPECT().SpendBonus(gomock.Any(), 7, gomock.Any()).Return(nil)
+
+	body := `{"order": "2377225624", "sum": 751, "password": "s3cr3t-pass"}`
+	req := adminRequestWithBody(t, http.MethodPost, "/api/user/balance/withdraw?token=query-jwt&dry_run=1", body, 7, model.RoleUser)
+	jwt := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	w := httptest.NewRecorder()
+	Router(h).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %v, want %v", w.Code, http.StatusOK)
+	}
+	for _, secret := range []string{jwt, "query-jwt", "s3cr3t-pass"} {
+		if strings.Contains(logs.String(), secret) {
+			t.Errorf("secret %q reached log:\n%s", secret, logs.String())
+		}
+	}
+	if !strings.Contains(logs.String(), "2377225624") {
+		t.Errorf("payment body is not logged:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,495 @@
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openapiSpec describes every route of Router, route_coverage test keeps them in sync
+//
+//go:embed openapi.json
+var openapiSpec []byte
+
+// OpenAPI serves OpenAPI 3 document of the API
+func (h *Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapiSpec)
+}
+
+// WithSpecValidation checks requests and responses against OpenAPI document.
+// In strict mode response that does not match is replaced with 500, otherwise it's only logged.
+// It's meant for dev and test environments, validation is not free.
+func WithSpecValidation(strict bool) HandlerOption {
+	return func(h *Handler) {
+		h.spec = mustLoadSpec()
+		h.spec.strict = strict
+	}
+}
+
+// openapiDoc is the part of OpenAPI 3 document used by validator
+type openapiDoc struct {
+	Paths      map[string]map[string]*openapiOperation `json:"paths"`
+	Components struct {
+		Schemas   map[string]*jsonSchema      `json:"schemas"`
+		Responses map[string]*openapiResponse `json:"responses"`
+	} `json:"components"`
+}
+
+type openapiOperation struct {
+	Parameters  []openapiParameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool                        `json:"required"`
+		Content  map[string]openapiMediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]*openapiResponse `json:"responses"`
+}
+
+type openapiParameter struct {
+	Name     string      `json:"name"`
+	In       string      `json:"in"`
+	Required bool        `json:"required"`
+	Schema   *jsonSchema `json:"schema"`
+}
+
+type openapiResponse struct {
+	Ref     string                      `json:"$ref"`
+	Content map[string]openapiMediaType `json:"content"`
+}
+
+type openapiMediaType struct {
+	Schema *jsonSchema `json:"schema"`
+}
+
+// jsonSchema supports subset of schema object used in openapi.json
+type jsonSchema struct {
+	Ref        string                 `json:"$ref"`
+	Type       string                 `json:"type"`
+	Format     string                 `json:"format"`
+	Pattern    string                 `json:"pattern"`
+	Enum       []string               `json:"enum"`
+	Minimum    *float64               `json:"minimum"`
+	Maximum    *float64               `json:"maximum"`
+	Properties map[string]*jsonSchema `json:"properties"`
+	Required   []string               `json:"required"`
+	Items      *jsonSchema            `json:"items"`
+	OneOf      []*jsonSchema          `json:"oneOf"`
+	// Pattern компилируется при загрузке документа
+	re *regexp.Regexp
+}
+
+// schemaKeywords are checked by validator or don't affect validation
+var schemaKeywords = map[string]bool{
+	"$ref": true, "type": true, "format": true, "pattern": true, "enum": true, "minimum": true, "maximum": true,
+	"properties": true, "required": true, "items": true, "oneOf": true,
+	"description": true, "example": true, "title": true, "deprecated": true,
+}
+
+// UnmarshalJSON rejects keywords which validator would silently ignore, e.g. additionalProperties or nullable,
+// so openapi.json doesn't promise checks that are not done
+func (s *jsonSchema) UnmarshalJSON(data []byte) error {
+	var keywords map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keywords); err != nil {
+		return err
+	}
+	for k := range keywords {
+		if !schemaKeywords[k] {
+			return fmt.Errorf("schema keyword %s is not supported by validator", k)
+		}
+	}
+	type plain jsonSchema
+	if err := json.Unmarshal(data, (*plain)(s)); err != nil {
+		return err
+	}
+	switch s.Type {
+	case "", "object", "array", "string", "integer", "number", "boolean":
+	default:
+		return fmt.Errorf("schema type %s is not supported by validator", s.Type)
+	}
+	if s.Format != "" && s.Format != "date-time" {
+		return fmt.Errorf("schema format %s is not supported by validator", s.Format)
+	}
+	if len(s.Enum) > 0 && s.Type != "string" {
+		return fmt.Errorf("enum is supported only for strings")
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("schema pattern: %w", err)
+		}
+		s.re = re
+	}
+	return nil
+}
+
+type specRoute struct {
+	segments []string
+	params   int
+	methods  map[string]*openapiOperation
+}
+
+type specValidator struct {
+	doc    openapiDoc
+	routes []specRoute
+	strict bool
+}
+
+func mustLoadSpec() *specValidator {
+	v, err := loadSpec(openapiSpec)
+	if err != nil {
+		panic(fmt.Sprintf("openapi.json: %s", err))
+	}
+	return v
+}
+
+func loadSpec(data []byte) (*specValidator, error) {
+	v := &specValidator{}
+	if err := json.Unmarshal(data, &v.doc); err != nil {
+		return nil, err
+	}
+	for path, item := range v.doc.Paths {
+		route := specRoute{segments: strings.Split(strings.Trim(path, "/"), "/"), methods: make(map[string]*openapiOperation)}
+		for _, seg := range route.segments {
+			if strings.HasPrefix(seg, "{") {
+				route.params++
+			}
+		}
+		for method, op := range item {
+			route.methods[strings.ToUpper(method)] = op
+		}
+		v.routes = append(v.routes, route)
+	}
+	return v, nil
+}
+
+// find returns operation for request, literal segments win over parameters like in http.ServeMux
+func (v *specValidator) find(method, path string) (*openapiOperation, map[string]string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var found *specRoute
+	for i := range v.routes {
+		route := &v.routes[i]
+		if len(route.segments) != len(segments) || route.methods[method] == nil {
+			continue
+		}
+		if found != nil && found.params <= route.params {
+			continue
+		}
+		match := true
+		for j, seg := range route.segments {
+			if !strings.HasPrefix(seg, "{") && seg != segments[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			found = route
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	params := make(map[string]string)
+	for j, seg := range found.segments {
+		if strings.HasPrefix(seg, "{") {
+			params[strings.Trim(seg, "{}")] = segments[j]
+		}
+	}
+	return found.methods[method], params
+}
+
+// streaming operations answer with WebSocket or SSE, their responses can't be buffered
+func (op *openapiOperation) streaming() bool {
+	for code, resp := range op.Responses {
+		if code == "101" {
+			return true
+		}
+		if _, ok := resp.Content["text/event-stream"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *specValidator) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op, params := v.find(r.Method, r.URL.Path)
+		if op == nil {
+			// маршрута нет в документе, ответит сам роутер
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := v.checkRequest(op, params, r); err != nil {
+			writeError(w, r, http.StatusBadRequest, codeRequestSpec, err.Error())
+			return
+		}
+		if op.streaming() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &specRecorder{header: make(http.Header)}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if err := v.checkResponse(op, rec); err != nil {
+			slog.WarnContext(r.Context(), "response does not match openapi spec",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.status),
+				slog.String("error", err.Error()),
+			)
+			if v.strict {
+				writeError(w, r, http.StatusInternalServerError, codeResponseSpec, err.Error())
+				return
+			}
+		}
+		for k, vals := range rec.header {
+			w.Header()[k] = vals
+		}
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+	})
+}
+
+func (v *specValidator) checkRequest(op *openapiOperation, pathParams map[string]string, r *http.Request) error {
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		var values []string
+		switch p.In {
+		case "path":
+			values = []string{pathParams[p.Name]}
+		case "query":
+			values = query[p.Name]
+		case "header":
+			values = r.Header.Values(p.Name)
+		}
+		if len(values) == 0 {
+			if p.Required {
+				return fmt.Errorf("%s parameter %s is required", p.In, p.Name)
+			}
+			continue
+		}
+		for _, val := range values {
+			if err := v.checkParam(p.Schema, val); err != nil {
+				return fmt.Errorf("%s parameter %s: %w", p.In, p.Name, err)
+			}
+		}
+	}
+	if op.RequestBody == nil {
+		return nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) == 0 {
+		if op.RequestBody.Required {
+			return fmt.Errorf("request body is required")
+		}
+		return nil
+	}
+	return v.checkBody(op.RequestBody.Content, r.Header.Get("Content-Type"), body, "request body")
+}
+
+func (v *specValidator) checkResponse(op *openapiOperation, rec *specRecorder) error {
+	resp, ok := op.Responses[strconv.Itoa(rec.status)]
+	if !ok {
+		if resp, ok = op.Responses["default"]; !ok {
+			return fmt.Errorf("status %d is not documented", rec.status)
+		}
+	}
+	if resp.Ref != "" {
+		resp = v.doc.Components.Responses[strings.TrimPrefix(resp.Ref, "#/components/responses/")]
+		if resp == nil {
+			return fmt.Errorf("unknown response reference")
+		}
+	}
+	// тело без описанного содержимого - например, текст от http.Error, не проверяем
+	if len(resp.Content) == 0 || rec.body.Len() == 0 {
+		return nil
+	}
+	return v.checkBody(resp.Content, rec.header.Get("Content-Type"), rec.body.Bytes(), "response body")
+}
+
+func (v *specValidator) checkBody(content map[string]openapiMediaType, contentType string, body []byte, name string) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%s: invalid content type %q", name, contentType)
+	}
+	mt, ok := content[mediaType]
+	if !ok {
+		return fmt.Errorf("%s: content type %s is not documented", name, mediaType)
+	}
+	if mt.Schema == nil {
+		return nil
+	}
+	if !strings.HasSuffix(mediaType, "json") {
+		return v.checkParam(mt.Schema, string(body))
+	}
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("%s: malformed JSON", name)
+	}
+	if err := v.checkValue(mt.Schema, value, "$"); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// checkParam converts text of parameter to the type of schema before check
+func (v *specValidator) checkParam(s *jsonSchema, text string) error {
+	s = v.resolve(s)
+	if s == nil {
+		return nil
+	}
+	var value any = text
+	switch s.Type {
+	case "integer", "number":
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a %s", text, s.Type)
+		}
+		value = n
+	case "boolean":
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", text)
+		}
+		value = b
+	}
+	return v.checkValue(s, value, "value")
+}
+
+func (v *specValidator) resolve(s *jsonSchema) *jsonSchema {
+	for s != nil && s.Ref != "" {
+		s = v.doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+func (v *specValidator) checkValue(s *jsonSchema, value any, at string) error {
+	s = v.resolve(s)
+	if s == nil {
+		return nil
+	}
+	if len(s.OneOf) > 0 {
+		matched := 0
+		for _, alt := range s.OneOf {
+			if v.checkValue(alt, value, at) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return fmt.Errorf("%s must match exactly one schema of oneOf, matched %d", at, matched)
+		}
+		return nil
+	}
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s must be an object", at)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s.%s is required", at, name)
+			}
+		}
+		for name, prop := range s.Properties {
+			if val, ok := obj[name]; ok {
+				if err := v.checkValue(prop, val, at+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s must be an array", at)
+		}
+		for i, item := range arr {
+			if err := v.checkValue(s.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string", at)
+		}
+		return checkString(s, str, at)
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("%s must be a %s", at, s.Type)
+		}
+		if s.Type == "integer" && n != math.Trunc(n) {
+			return fmt.Errorf("%s must be an integer", at)
+		}
+		if (s.Minimum != nil && n < *s.Minimum) || (s.Maximum != nil && n > *s.Maximum) {
+			return fmt.Errorf("%s is out of range", at)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", at)
+		}
+	}
+	return nil
+}
+
+func checkString(s *jsonSchema, str, at string) error {
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if e == str {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s must be one of %s", at, strings.Join(s.Enum, ", "))
+		}
+	}
+	if s.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+			return fmt.Errorf("%s must be RFC 3339 date-time", at)
+		}
+	}
+	if s.re != nil && !s.re.MatchString(str) {
+		return fmt.Errorf("%s must match %s", at, s.Pattern)
+	}
+	return nil
+}
+
+// specRecorder buffers response until it is checked
+type specRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *specRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *specRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *specRecorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(b)
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gophermart/internal/mock"
+	"gophermart/internal/model"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// routerRoutes collects "METHOD /path" of every HandleFunc in router.go, following Mount prefixes
+func routerRoutes(t *testing.T) map[string]bool {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "router.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefixes := map[string]string{"router": ""}
+	routes := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			call, ok := n.Rhs[0].(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			parent, ok := sel.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			prefix, known := prefixes[parent.Name]
+			if !known {
+				return true
+			}
+			name := n.Lhs[0].(*ast.Ident).Name
+			switch sel.Sel.Name {
+			case "Mount":
+				prefixes[name] = prefix + stringArg(t, call)
+			case "Group":
+				prefixes[name] = prefix
+			}
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "HandleFunc" {
+				return true
+			}
+			group := sel.X.(*ast.Ident).Name
+			prefix, known := prefixes[group]
+			if !known {
+				t.Fatalf("unknown route group %s", group)
+			}
+			method, path, _ := strings.Cut(stringArg(t, n), " ")
+			routes[method+" "+prefix+path] = true
+		}
+		return true
+	})
+	return routes
+}
+
+func stringArg(t *testing.T, call *ast.CallExpr) string {
+	t.Helper()
+	lit, ok := call.Args[0].(*ast.BasicLit)
+	if !ok {
+		t.Fatalf("route pattern must be string literal")
+	}
+	s, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestOpenAPI_RouteCoverage(t *testing.T) {
+	spec, err := loadSpec(openapiSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documented := make(map[string]bool)
+	for path, item := range spec.doc.Paths {
+		for method := range item {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	routes := routerRoutes(t)
+	if len(routes) == 0 {
+		t.Fatal("no routes found in router.go")
+	}
+	for route := range routes {
+		if !documented[route] {
+			t.Errorf("route %s is missing in openapi.json", route)
+		}
+	}
+	for route := range documented {
+		if !routes[route] {
+			t.Errorf("openapi.json documents %s, but router does not serve it", route)
+		}
+	}
+}
+
+func TestLoadSpec_Unsupported(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+	}{
+		{name: "additional_properties", schema: `{"type": "object", "additionalProperties": false}`},
+		{name: "min_length", schema: `{"type": "string", "minLength": 1}`},
+		{name: "max_items", schema: `{"type": "array", "items": {"type": "string"}, "maxItems": 10}`},
+		{name: "all_of", schema: `{"allOf": [{"type": "string"}]}`},
+		{name: "nullable", schema: `{"type": "string", "nullable": true}`},
+		{name: "exclusive_minimum", schema: `{"type": "number", "exclusiveMinimum": 0}`},
+		{name: "nested", schema: `{"type": "object", "properties": {"id": {"type": "integer", "multipleOf": 2}}}`},
+		{name: "format", schema: `{"type": "string", "format": "uri"}`},
+		{name: "integer_enum", schema: `{"type": "integer", "enum": ["1"]}`},
+		{name: "invalid_pattern", schema: `{"type": "string", "pattern": "^[0-9+$"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := `{"components": {"schemas": {"Item": ` + tt.schema + `}}}`
+			if _, err := loadSpec([]byte(doc)); err == nil {
+				t.Errorf("schema %s is accepted", tt.schema)
+			}
+		})
+	}
+}
+
+func TestOpenAPI_Validation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockStore := mock.NewMockStore(ctrl)
+	h := NewHandler(mockStore, NewMockPoller(ctrl), WithSpecValidation(true))
+	router := Router(h)
+
+	t.Run("document_is_served", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+		if w.Code != http.StatusOK || !json.Valid(w.Body.Bytes()) {
+			t.Errorf("got status %v, want %v with JSON body", w.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("valid_response", func(t *testing.T) {
+		mockStore.EXPECT().UserAccess(gomock.Any(), 7).Return(false, model.RoleUser, nil)
+		mockStore.EXPECT().GetBalance(gomock.Any(), 7).Return(&Balance{Sum: 500.5, WriteOff: 42}, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, adminRequest(t, http.MethodGet, "/api/user/balance", 7, model.RoleUser))
+		if w.Code != http.StatusOK {
+			t.Errorf("got status %v, want %v: %s", w.Code, http.StatusOK, w.Body)
+		}
+	})
+
+	t.Run("invalid_request", func(t *testing.T) {
+		// номер заказа должен передаваться строкой, до хранилища запрос не доходит
+		req := adminRequestWithBody(t, http.MethodPost, "/api/user/balance/withdraw", `{"order": 2377225624, "sum": 751}`, 7, model.RoleUser)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assertProblemCode(t, w, http.StatusBadRequest, codeRequestSpec)
+	})
+
+	t.Run("invalid_response", func(t *testing.T) {
+		broken := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"current": "500.5"}`))
+		})
+		w := httptest.NewRecorder()
+		h.spec.middleware(broken).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/user/balance", nil))
+		assertProblemCode(t, w, http.StatusInternalServerError, codeResponseSpec)
+	})
+
+	t.Run("undocumented_status", func(t *testing.T) {
+		teapot := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+		w := httptest.NewRecorder()
+		h.spec.middleware(teapot).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/user/balance", nil))
+		assertProblemCode(t, w, http.StatusInternalServerError, codeResponseSpec)
+	})
+}
+
+func assertProblemCode(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("got status %v, want %v", w.Code, status)
+	}
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != code {
+		t.Errorf("got code %s, want %s", p.Code, code)
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gophermart/internal/model"
+)
+
+const (
+	pageLimitDefault = 50
+	pageLimitMax     = 1000
+)
+
+type Cursor = model.Cursor
+
+// Page is a response of paginated list endpoints
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// pageParams are common query parameters of paginated lists
+type pageParams struct {
+	limit int
+	after *Cursor
+	from  time.Time
+	to    time.Time
+}
+
+func encodeCursor(c Cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	c := &Cursor{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return c, nil
+}
+
+func parseTimeParam(q url.Values, name string) (time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, fmt.Errorf("invalid %s: expected RFC 3339 time", name)
+	}
+	return t, nil
+}
+
+func parsePageParams(q url.Values) (pageParams, error) {
+	p := pageParams{limit: pageLimitDefault}
+	var err error
+	if v := q.Get("limit"); v != "" {
+		p.limit, err = strconv.Atoi(v)
+		if err != nil || p.limit <= 0 || p.limit > pageLimitMax {
+			return p, fmt.Errorf("limit must be from 1 to %d", pageLimitMax)
+		}
+	}
+	if v := q.Get("cursor"); v != "" {
+		if p.after, err = decodeCursor(v); err != nil {
+			return p, err
+		}
+	}
+	if p.from, err = parseTimeParam(q, "from"); err != nil {
+		return p, err
+	}
+	if p.to, err = parseTimeParam(q, "to"); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// multiParam returns values of repeated or comma separated query parameter
+func multiParam(q url.Values, name string) []string {
+	var res []string
+	for _, v := range q[name] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				res = append(res, item)
+			}
+		}
+	}
+	return res
+}
+
+// paginate makes page of items fetched with limit+1, the extra item means there is next page.
+// Link header to the next page is set as well.
+func paginate[T any](w http.ResponseWriter, r *http.Request, items []T, limit int, cursor func(T) Cursor) Page[T] {
+	page := Page[T]{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.NextCursor = encodeCursor(cursor(page.Items[limit-1]))
+		next := *r.URL
+		q := next.Query()
+		q.Set("cursor", page.NextCursor)
+		next.RawQuery = q.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	}
+	return page
+}
@@ -5,6 +5,7 @@
 package api
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -34,13 +35,25 @@ func (m *MockPoller) EXPECT() *MockPollerMockRecorder {
 }
 
 // Push mocks base method.
-func (m *MockPoller) Push(arg0 int) {
+func (m *MockPoller) Push(arg0 context.Context, arg1 int) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Push", arg0)
+	m.ctrl.Call(m, "Push", arg0, arg1)
 }
 
 // Push indicates an expected call of Push.
-func (mr *MockPollerMockRecorder) Push(arg0 interface{}) *gomock.Call {
+func (mr *MockPollerMockRecorder) Push(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Push", reflect.TypeOf((*MockPoller)(nil).Push), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Push", reflect.TypeOf((*MockPoller)(nil).Push), arg0, arg1)
+}
+
+// PushBatch mocks base method.
+func (m *MockPoller) PushBatch(arg0 context.Context, arg1 []int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "PushBatch", arg0, arg1)
+}
+
+// PushBatch indicates an expected call of PushBatch.
+func (mr *MockPollerMockRecorder) PushBatch(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PushBatch", reflect.TypeOf((*MockPoller)(nil).PushBatch), arg0, arg1)
 }
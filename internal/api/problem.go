@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"gophermart/internal/policy"
+)
+
+// Stable error codes, clients may branch on them
+const (
+	codeInvalidRequest        = "invalid_request"
+	codeUnauthorized          = "unauthorized"
+	codeForbidden             = "forbidden"
+	codeUserBlocked           = "user_blocked"
+	codeInvalidCredentials    = "invalid_credentials"
+	codeCredentialsPolicy     = "credentials_policy_violation"
+	codeLoginTaken            = "login_taken"
+	codeTooManyLoginAttempts  = "too_many_login_attempts"
+	codeInvalidOrderNumber    = "invalid_order_number"
+	codeOrderOwnedByOtherUser = "order_owned_by_other_user"
+	codeOrderNotFound         = "order_not_found"
+	codeOrderFinal            = "order_final"
+	codeInsufficientFunds     = "insufficient_funds"
+	codeInvalidAmount         = "invalid_amount"
+	codeBatchTooLarge         = "batch_too_large"
+	codeUserNotFound          = "user_not_found"
+	codeInvalidAdjustment     = "invalid_adjustment"
+	codeMerchantKeyNotFound   = "merchant_key_not_found"
+	codeWebhookNotFound       = "webhook_not_found"
+	codeDeliveryNotFound      = "delivery_not_found"
+	codeNotImplemented        = "not_implemented"
+	codeRequestSpec           = "request_does_not_match_spec"
+	codeResponseSpec          = "response_does_not_match_spec"
+	codeInternal              = "internal_error"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem is an error response in RFC 7807 format with code extension member
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Code      string `json:"code"`
+	Detail    string `json:"detail,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// поля нарушенного правила регистрации, см. policy.Violation
+	Field string `json:"field,omitempty"`
+	Rule  string `json:"rule,omitempty"`
+}
+
+func newProblem(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "urn:gophermart:problem:" + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Code + ": " + p.Detail
+	}
+	return p.Code
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	p.RequestID = requestID(r.Context())
+	resp, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	w.Write(resp)
+}
+
+// writeError renders problem, detail is shown to client as is
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	writeProblem(w, r, newProblem(status, code, detail))
+}
+
+// internalError logs err with request id and answers with generic 500, error details never reach client
+func internalError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "internal error",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("error", err.Error()),
+	)
+	writeError(w, r, http.StatusInternalServerError, codeInternal, "")
+}
+
+// policyProblem converts violation of credentials policy to problem
+func policyProblem(status int, err error) (*Problem, bool) {
+	var v *policy.Violation
+	if !errors.As(err, &v) {
+		return nil, false
+	}
+	code := codeCredentialsPolicy
+	if v.Rule == policy.RuleLoginTaken {
+		code = codeLoginTaken
+	}
+	p := newProblem(status, code, v.Message)
+	p.Field = v.Field
+	p.Rule = v.Rule
+	return p, true
+}
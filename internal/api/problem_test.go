@@ -0,0 +1,41 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gophermart/internal/mock"
+	"gophermart/internal/model"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+func TestProblem_OrderOwnedByOtherUser(t *testing.T) {
+	h := setupHandler(t)
+	m := h.store.(*mock.MockStore)
+	m.EXPECT().UserAccess(gomock.Any(), 7).Return(false, model.RoleUser, nil)
+	m.EXPECT().AddOrder(gomock.Any(), 7992723465, 7, 0).Return(model.OrderStatus(-1), model.ErrOrderExists)
+
+	tkn, _ := BuildJWT(7, model.RoleUser)
+	req := httptest.NewRequest(http.MethodPost, "/api/user/orders", bytes.NewBufferString("7992723465"))
+	req.Header.Set("Authorization", "Bearer "+tkn)
+	w := httptest.NewRecorder()
+	Router(h).ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("got status %v, want %v", w.Code, http.StatusConflict)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != problemContentType {
+		t.Errorf("got content type %s, want %s", ct, problemContentType)
+	}
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != codeOrderOwnedByOtherUser || p.Status != http.StatusConflict || p.RequestID == "" {
+		t.Errorf("unexpected problem %+v", p)
+	}
+}
@@ -3,12 +3,23 @@ package api
 import (
 	"net/http"
 
+	"gophermart/internal/model"
+
 	"github.com/go-pkgz/routegroup"
 )
 
 func Router(h *Handler) http.Handler {
 	router := routegroup.New(http.NewServeMux())
-	router.Use(loggingMiddleware)
+	router.Use(loggingMiddleware, tracingMiddleware(router), metricsMiddleware(router))
+	if h.spec != nil {
+		router.Use(h.spec.middleware)
+	}
+	router.HandleFunc("GET /api/openapi.json", h.OpenAPI)
+	router.HandleFunc("GET /healthz", h.Healthz)
+	router.HandleFunc("GET /readyz", h.Readyz)
+	if h.metrics != nil {
+		router.HandleFunc("GET /metrics", h.metrics.ServeHTTP)
+	}
 
 	// create a new group for the /api/user path
 	apiRouter := router.Mount("/api/user")
@@ -16,12 +27,59 @@ func Router(h *Handler) http.Handler {
 	apiRouter.HandleFunc("POST /login", h.Login)
 
 	protectedGroup := apiRouter.Group()
-	protectedGroup.Use(authMiddleware)
+	protectedGroup.Use(authMiddleware, h.activeUserMiddleware)
 	protectedGroup.HandleFunc("POST /orders", h.NewOrder)
+	protectedGroup.HandleFunc("POST /orders/batch", h.NewOrderBatch)
 	protectedGroup.HandleFunc("GET /orders", h.OrderList)
+	protectedGroup.HandleFunc("GET /orders/{number}", h.OrderDetail)
+	protectedGroup.HandleFunc("GET /orders/events", h.OrderEvents)
 	protectedGroup.HandleFunc("GET /balance", h.Balance)
 	protectedGroup.HandleFunc("POST /balance/withdraw", h.Pay)
 	protectedGroup.HandleFunc("GET /withdrawals", h.PaymentList)
+	protectedGroup.HandleFunc("GET /adjustments", h.Adjustments)
+	protectedGroup.HandleFunc("GET /webhooks", h.Webhooks)
+	protectedGroup.HandleFunc("POST /webhooks", h.CreateWebhook)
+	protectedGroup.HandleFunc("DELETE /webhooks/{id}", h.DeleteWebhook)
+	protectedGroup.HandleFunc("GET /webhooks/{id}/deliveries", h.WebhookDeliveries)
+	protectedGroup.HandleFunc("POST /webhooks/{id}/deliveries/{delivery}/redeliver", h.RedeliverWebhook)
+
+	wsGroup := apiRouter.Group()
+	wsGroup.Use(wsTokenMiddleware, authMiddleware, h.activeUserMiddleware)
+	wsGroup.HandleFunc("GET /ws", h.UserWS)
+
+	adminRouter := router.Mount("/api/admin")
+	adminRouter.Use(authMiddleware, h.activeUserMiddleware, adminMiddleware)
+	adminRouter.HandleFunc("GET /users", h.AdminSearchUsers)
+	adminRouter.HandleFunc("GET /users/{id}/orders", h.AdminUserOrders)
+	adminRouter.HandleFunc("GET /users/{id}/balance", h.AdminUserBalance)
+	adminRouter.HandleFunc("GET /users/{id}/withdrawals", h.AdminUserWithdrawals)
+	adminRouter.HandleFunc("GET /users/{id}/adjustments", h.AdminUserAdjustments)
+	adminRouter.HandleFunc("POST /users/{id}/adjustments", h.AdminAdjustBalance)
+	adminRouter.HandleFunc("POST /users/{id}/block", h.AdminBlockUser)
+	adminRouter.HandleFunc("POST /users/{id}/unblock", h.AdminUnblockUser)
+	adminRouter.HandleFunc("POST /orders/{number}/requeue", h.AdminRequeueOrder)
+	adminRouter.HandleFunc("GET /merchant-keys", h.AdminMerchantKeys)
+	adminRouter.HandleFunc("POST /merchant-keys", h.AdminCreateMerchantKey)
+	adminRouter.HandleFunc("POST /merchant-keys/{id}/revoke", h.AdminRevokeMerchantKey)
+	adminRouter.HandleFunc("GET /log-level", h.AdminLogLevel)
+	adminRouter.HandleFunc("PUT /log-level", h.AdminSetLogLevel)
+
+	// server-to-server API of storefront backends
+	merchantRouter := router.Mount("/api/merchant")
+	merchantOrders := merchantRouter.Group()
+	merchantOrders.Use(h.merchantMiddleware(model.ScopeOrdersWrite))
+	merchantOrders.HandleFunc("POST /orders", h.MerchantNewOrder)
+
+	merchantWebhooks := merchantRouter.Group()
+	merchantWebhooks.Use(h.merchantMiddleware(model.ScopeWebhooks))
+	merchantWebhooks.HandleFunc("GET /webhooks", h.Webhooks)
+	merchantWebhooks.HandleFunc("POST /webhooks", h.CreateWebhook)
+	merchantWebhooks.HandleFunc("DELETE /webhooks/{id}", h.DeleteWebhook)
+	merchantWebhooks.HandleFunc("GET /webhooks/{id}/deliveries", h.WebhookDeliveries)
+	merchantWebhooks.HandleFunc("POST /webhooks/{id}/deliveries/{delivery}/redeliver", h.RedeliverWebhook)
 
+	if h.cors != nil {
+		return h.cors.middleware(router)
+	}
 	return router
 }
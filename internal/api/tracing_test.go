@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gophermart/internal/mock"
+	"gophermart/internal/model"
+	"gophermart/internal/tracing"
+
+	gomock "github.com/golang/mock/gomock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRouter_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	h := setupHandler(t)
+	m := h.store.(*mock.MockStore)
+	m.EXPECT().UserAccess(gomock.Any(), 7).Return(false, model.RoleUser, nil)
+	m.EXPECT().AddOrder(gomock.Any(), 7992723465, 7, 0).Return(model.OrderStatusNew, nil)
+	h.poller.(*MockPoller).EXPECT().Push(gomock.Any(), 7992723465)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := adminRequestWithBody(t, http.MethodPost, "/api/user/orders", "7992723465", 7, model.RoleUser)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	Router(h).ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("got status %v, want %v", w.Code, http.StatusAccepted)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "POST /api/user/orders" || span.SpanContext().TraceID().String() != traceID {
+		t.Errorf("got span %s in trace %s", span.Name(), span.SpanContext().TraceID())
+	}
+	found := false
+	for _, attr := range span.Attributes() {
+		if attr.Key == tracing.AttrOrderID && attr.Value.AsInt64() == 7992723465 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("span has no %s attribute: %v", tracing.AttrOrderID, span.Attributes())
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gophermart/internal/model"
+	"gophermart/internal/webhook"
+)
+
+const (
+	webhookSecretPrefix = "whsec_"
+	webhookSecretMinLen = 16
+)
+
+// webhookOwner is merchant key for merchant API and authenticated user otherwise
+func webhookOwner(r *http.Request) model.WebhookOwner {
+	if key, ok := r.Context().Value(merchantCtxKey{}).(*MerchantKey); ok {
+		return model.WebhookOwner{MerchantKeyID: key.ID}
+	}
+	return model.WebhookOwner{UserID: r.Context().Value(userIDCtxKey{}).(int)}
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + hex.EncodeToString(b), nil
+}
+
+func validateWebhook(wh Webhook) error {
+	if err := webhook.CheckURL(wh.URL); err != nil {
+		return err
+	}
+	if len(wh.Events) == 0 {
+		return errors.New("events are required")
+	}
+	for _, event := range wh.Events {
+		if !model.ValidWebhookEvent(event) {
+			return fmt.Errorf("unknown event %s", event)
+		}
+	}
+	if wh.Secret != "" && len(wh.Secret) < webhookSecretMinLen {
+		return fmt.Errorf("secret must be at least %d characters", webhookSecretMinLen)
+	}
+	return nil
+}
+
+// CreateWebhook subscribes owner to events. Secret is generated unless given, it's returned only once.
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var wh Webhook
+	if err := json.NewDecoder(r.Body).Decode(&wh); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "malformed JSON body")
+		return
+	}
+	if err := validateWebhook(wh); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	var err error
+	if wh.Secret == "" {
+		if wh.Secret, err = newWebhookSecret(); err != nil {
+			internalError(w, r, err)
+			return
+		}
+	}
+	wh.Owner = webhookOwner(r)
+	wh.CreatedAt = time.Now()
+	wh.ID, err = h.store.AddWebhook(r.Context(), wh)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, wh)
+}
+
+func (h *Handler) Webhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := h.store.ListWebhooks(r.Context(), webhookOwner(r))
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, hooks)
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid webhook id")
+		return
+	}
+	err = h.store.DeleteWebhook(r.Context(), webhookOwner(r), id)
+	if errors.Is(err, model.ErrNoWebhook) {
+		writeError(w, r, http.StatusNotFound, codeWebhookNotFound, "")
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// WebhookDeliveries returns delivery log of webhook, newest first
+func (h *Handler) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid webhook id")
+		return
+	}
+	p, err := parsePageParams(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	deliveries, err := h.store.ListWebhookDeliveries(r.Context(), webhookOwner(r), id, p.limit)
+	if errors.Is(err, model.ErrNoWebhook) {
+		writeError(w, r, http.StatusNotFound, codeWebhookNotFound, "")
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, deliveries)
+}
+
+// RedeliverWebhook queues delivery again, e.g. after partner fixed its endpoint
+func (h *Handler) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid webhook id")
+		return
+	}
+	deliveryID, err := strconv.ParseInt(r.PathValue("delivery"), 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid delivery id")
+		return
+	}
+	err = h.store.RedeliverWebhook(r.Context(), webhookOwner(r), id, deliveryID)
+	if errors.Is(err, model.ErrNoDelivery) {
+		writeError(w, r, http.StatusNotFound, codeDeliveryNotFound, "")
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gophermart/internal/mock"
+	"gophermart/internal/model"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+func TestHandler_CreateWebhook(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		stored     bool
+		statusCode int
+	}{
+		{
+			name:       "created",
+			body:       `{"url": "https://partner.example/hooks", "events": ["order.processed", "withdrawal.created"]}`,
+			stored:     true,
+			statusCode: http.StatusCreated,
+		},
+		{
+			name:       "unknown_event",
+			body:       `{"url": "https://partner.example/hooks", "events": ["order.deleted"]}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "internal_address",
+			body:       `{"url": "http://169.254.169.254/latest/meta-data", "events": ["order.invalid"]}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "relative_url",
+			body:       `{"url": "/hooks", "events": ["order.invalid"]}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "short_secret",
+			body:       `{"url": "https://partner.example/hooks", "events": ["order.invalid"], "secret": "123"}`,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := setupHandler(t)
+			m := h.store.(*mock.MockStore)
+			m.EXPECT().UserAccess(gomock.Any(), 7).Return(false, model.RoleUser, nil)
+			if tt.stored {
+				m.EXPECT().AddWebhook(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, wh Webhook) (int, error) {
+					if wh.Owner != (model.WebhookOwner{UserID: 7}) {
+						t.Errorf("got owner %+v", wh.Owner)
+					}
+					return 3, nil
+				})
+			}
+			w := httptest.NewRecorder()
+			req := adminRequestWithBody(t, http.MethodPost, "/api/user/webhooks", tt.body, 7, model.RoleUser)
+			Router(h).ServeHTTP(w, req)
+
+			if w.Code != tt.statusCode {
+				t.Fatalf("got status %v, want %v", w.Code, tt.statusCode)
+			}
+			if !tt.stored {
+				return
+			}
+			var got Webhook
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != 3 || !strings.HasPrefix(got.Secret, webhookSecretPrefix) {
+				t.Errorf("unexpected webhook in response %+v", got)
+			}
+		})
+	}
+}
+
+func TestHandler_MerchantWebhooks(t *testing.T) {
+	apiKey := "gm_0123456789abcdef"
+	h := setupHandler(t)
+	m := h.store.(*mock.MockStore)
+	m.EXPECT().GetMerchantKey(gomock.Any(), hashMerchantKey(apiKey)).
+		Return(&MerchantKey{ID: 4, Scopes: []string{model.ScopeWebhooks}}, nil)
+	m.EXPECT().ListWebhooks(gomock.Any(), model.WebhookOwner{MerchantKeyID: 4}).
+		Return([]Webhook{{ID: 1, URL: "https://shop.example/hooks", Events: []string{model.WebhookOrderProcessed}}}, nil)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/merchant/webhooks", nil)
+	req.Header.Set("X-API-Key", apiKey)
+	Router(h).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %v, want %v", w.Code, http.StatusOK)
+	}
+	if strings.Contains(w.Body.String(), "secret") {
+		t.Error("secret must not be listed")
+	}
+}
+
+func TestHandler_RedeliverWebhook(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+	}{
+		{name: "queued", statusCode: http.StatusAccepted},
+		{name: "not_found", err: model.ErrNoDelivery, statusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := setupHandler(t)
+			m := h.store.(*mock.MockStore)
+			m.EXPECT().UserAccess(gomock.Any(), 7).Return(false, model.RoleUser, nil)
+			m.EXPECT().RedeliverWebhook(gomock.Any(), model.WebhookOwner{UserID: 7}, 3, int64(12)).Return(tt.err)
+
+			w := httptest.NewRecorder()
+			req := adminRequest(t, http.MethodPost, "/api/user/webhooks/3/deliveries/12/redeliver", 7, model.RoleUser)
+			Router(h).ServeHTTP(w, req)
+
+			if w.Code != tt.statusCode {
+				t.Errorf("got status %v, want %v", w.Code, tt.statusCode)
+			}
+		})
+	}
+}
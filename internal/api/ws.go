@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	wsPingInterval = 30 * time.Second
+	wsPongWait     = 2 * wsPingInterval // connection is dropped if client does not answer pings
+	wsWriteWait    = 10 * time.Second
+	wsSendBuffer   = 64 // messages queued for one connection before it is considered slow
+)
+
+// wsMessage is a typed notification sent to WebSocket clients
+type wsMessage struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// wsTokenMiddleware lets browsers pass JWT in query, they can't set headers of WebSocket handshake
+func wsTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tkn := r.URL.Query().Get("token"); tkn != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+tkn)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UserWS pushes user events over WebSocket. Client may resume with last_event_id query parameter.
+func (h *Handler) UserWS(w http.ResponseWriter, r *http.Request) {
+	if h.events == nil {
+		writeError(w, r, http.StatusNotImplemented, codeNotImplemented, "real-time events are disabled")
+		return
+	}
+	var lastID int64
+	if v := r.URL.Query().Get("last_event_id"); v != "" {
+		var err error
+		if lastID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid last_event_id")
+			return
+		}
+	}
+	userID := r.Context().Value(userIDCtxKey{}).(int)
+	srv := websocket.Server{
+		// клиенты аутентифицируются токеном, а не cookie, поэтому Origin не проверяем
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			h.serveWS(r.Context(), ws, userID, lastID)
+		},
+	}
+	srv.ServeHTTP(w, r)
+}
+
+func (h *Handler) serveWS(ctx context.Context, ws *websocket.Conn, userID int, lastID int64) {
+	// закрытие соединения завершает и чтение, в том числе при остановке сервера
+	defer ws.Close()
+	ctx, cancel := h.streamContext(ctx)
+	defer cancel()
+
+	events, stop, err := h.subscribe(ctx, userID, lastID)
+	if err != nil {
+		slog.ErrorContext(ctx, "ws subscribe", slog.String("error", err.Error()))
+		return
+	}
+	defer stop()
+
+	go func() {
+		defer cancel()
+		wsReadLoop(ws)
+	}()
+
+	send := make(chan wsMessage, wsSendBuffer)
+	go func() {
+		defer cancel()
+		for ev := range events {
+			msg := wsMessage{ID: ev.ID, Type: ev.Type, Data: ev.Data, CreatedAt: ev.CreatedAt}
+			select {
+			case send <- msg:
+			default:
+				// клиент не успевает читать, он переподключится с last_event_id
+				slog.WarnContext(ctx, "ws slow consumer disconnected")
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping.C:
+			if err := wsWrite(ws, websocket.PingFrame, nil); err != nil {
+				return
+			}
+		case msg := <-send:
+			b, err := json.Marshal(msg)
+			if err != nil {
+				return
+			}
+			if err := wsWrite(ws, websocket.TextFrame, b); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// wsWrite must be called from the single writer goroutine, it changes PayloadType of connection
+func wsWrite(ws *websocket.Conn, payloadType byte, msg []byte) error {
+	if err := ws.SetWriteDeadline(time.Now().Add(wsWriteWait)); err != nil {
+		return err
+	}
+	ws.PayloadType = payloadType
+	_, err := ws.Write(msg)
+	return err
+}
+
+// wsReadLoop discards client messages and answers pings until the connection is closed or pongs stop
+func wsReadLoop(ws *websocket.Conn) {
+	for {
+		if err := ws.SetReadDeadline(time.Now().Add(wsPongWait)); err != nil {
+			return
+		}
+		fr, err := ws.NewFrameReader()
+		if err != nil {
+			return
+		}
+		// HandleFrame отвечает на ping и возвращает nil для управляющих кадров
+		fr, err = ws.HandleFrame(fr)
+		if err != nil {
+			return
+		}
+		if fr == nil {
+			continue
+		}
+		if _, err = io.Copy(io.Discard, fr); err != nil {
+			return
+		}
+		if trailer := fr.TrailerReader(); trailer != nil {
+			if _, err = io.Copy(io.Discard, trailer); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	file := writeFile(t, "gophermart.yaml", `
+run_address: file:8080
+poll_interval: 7
+level: warn
+poll_concurrency: 4
+webhook_timeout: 3s
+admin_logins: [root]
+`)
+	environ := map[string]string{
+		"CONFIG_FILE":   file,
+		"RUN_ADDRESS":   "env:8080",
+		"POLL_INTERVAL": "5",
+		"LEVEL":         "",
+		"MODE":          "dev",
+	}
+	cfg, err := Load("gophermart", []string{"-a", "flag:8080"}, environ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		got, exp any
+	}{
+		{"flag_over_env", cfg.RunAddress, "flag:8080"},
+		{"env_over_file", cfg.PollInterval, 5},
+		{"empty_env_is_unset", cfg.Level, "warn"},
+		{"file_over_default", cfg.PollConcurrency, 4},
+		{"file_duration", cfg.WebhookTimeout, 3 * time.Second},
+		{"file_list", strings.Join(cfg.AdminLogins, ","), "root"},
+		{"default", cfg.OrdersBatchMax, 100},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.exp {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.exp)
+		}
+	}
+}
+
+func TestLoad_JSONFile(t *testing.T) {
+	file := writeFile(t, "gophermart.json", `{"mode": "dev", "jwt_lifetime": "1h", "db_max_conns": 20, "log_format": "json"}`)
+	cfg, err := Load("gophermart", []string{"-config", file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.JWTLifetime != time.Hour || cfg.DBMaxConns != 20 || cfg.LogFormat != "json" {
+		t.Errorf("file values are not applied: %+v", cfg)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		args    []string
+		environ map[string]string
+		want    []string
+	}{
+		{
+			name: "unknown_key",
+			file: "poll_intervl: 3\n",
+			want: []string{"poll_intervl"},
+		},
+		{
+			name:    "all_invalid_settings_are_reported",
+			environ: map[string]string{"LEVEL": "verbose", "POLL_CONCURRENCY": "-1", "MODE": "staging"},
+			args:    []string{"-r", "localhost:8090"},
+			want:    []string{"level:", "poll_concurrency:", "mode:", "accrual_system_address:"},
+		},
+		{
+			name: "http_outbox_without_url",
+			file: "outbox_publisher: http\n",
+			want: []string{"outbox_url: is required"},
+		},
+		{
+			name: "tls_and_server_limits",
+			file: "tls_cert_file: cert.pem\ntls_min_version: \"1.1\"\nhttp_read_header_timeout: 0s\nhttp_max_header_bytes: 100\n",
+			want: []string{"tls_cert_file:", "tls_min_version:", "http_read_header_timeout:", "http_max_header_bytes:"},
+		},
+		{
+			name: "no_jwt_secret_in_prod",
+			want: []string{"jwt_secret: is required"},
+		},
+		{
+			name:    "well_known_jwt_secret_in_prod",
+			environ: map[string]string{"JWT_SECRET": "supersecretkey"},
+			want:    []string{"jwt_secret: must not be the well-known default", "jwt_secret: must be at least 32 bytes"},
+		},
+		{
+			name:    "short_pii_key",
+			environ: map[string]string{"MODE": "dev", "LOG_PII_KEY": "short"},
+			want:    []string{"log_pii_key: must be at least 16 bytes"},
+		},
+		{
+			name:    "malformed_trusted_proxies",
+			environ: map[string]string{"MODE": "dev", "TRUSTED_PROXIES": "10.0.0.0/8,proxy.local"},
+			want:    []string{`trusted_proxies: "proxy.local" must be IP address or CIDR`},
+		},
+		{
+			name: "extra_argument",
+			args: []string{"serve"},
+			want: []string{"too many arguments"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append(args, "-config", writeFile(t, "gophermart.yaml", tt.file))
+			}
+			_, err := Load("gophermart", args, tt.environ)
+			if err == nil {
+				t.Fatal("invalid config is accepted")
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("error %q doesn't mention %q", err, w)
+				}
+			}
+		})
+	}
+}
+
+func TestConfig_Print(t *testing.T) {
+	environ := map[string]string{
+		"DATABASE_URI": "postgresql://app:db-pass@db:5432/gophermart?sslmode=disable",
+		"JWT_SECRET":   "jwt-signing-key-of-at-least-32-bytes",
+		"OUTBOX_URL":   "https://broker/events?token=broker-token",
+	}
+	cfg, err := Load("gophermart", []string{"-print-config"}, environ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.PrintConfig {
+		t.Fatal("print-config flag is not set")
+	}
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, secret := range []string{"db-pass", "jwt-signing-key", "broker-token"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("secret %q is printed:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "sslmode=disable") || !strings.Contains(out, "poll_interval: 2") {
+		t.Errorf("effective config is incomplete:\n%s", out)
+	}
+
+	// напечатанная конфигурация читается обратно, маскированный ключ допустим только вне prod
+	printed := writeFile(t, "printed.yaml", out)
+	if _, err := Load("gophermart", []string{"-config", printed}, map[string]string{"MODE": "dev"}); err != nil {
+		t.Errorf("printed config is not loadable: %v", err)
+	}
+}
+
+func TestConfig_Changed(t *testing.T) {
+	environ := map[string]string{"MODE": "dev"}
+	running, err := Load("gophermart", nil, environ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := writeFile(t, "gophermart.yaml", `
+level: debug
+poll_interval: 10
+cors_origins: ["https://shop.example"]
+run_address: localhost:9090
+`)
+	next, err := Load("gophermart", []string{"-config", file}, environ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, restart := running.Changed(next)
+	if got := strings.Join(live, ","); got != "poll_interval,level,cors_origins" {
+		t.Errorf("got live changes %s", got)
+	}
+	if got := strings.Join(restart, ","); got != "run_address" {
+		t.Errorf("got changes needing restart %s", got)
+	}
+
+	reloaded := running.Reloaded(next)
+	if reloaded.PollInterval != 10 || reloaded.RunAddress != running.RunAddress {
+		t.Errorf("only live settings must be reloaded: %+v", reloaded)
+	}
+	if _, restart := reloaded.Changed(next); len(restart) != 1 {
+		t.Errorf("setting needing restart must be reported until restart, got %v", restart)
+	}
+}
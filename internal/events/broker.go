@@ -0,0 +1,73 @@
+// Package events delivers user events to subscribers of this instance
+package events
+
+import (
+	"log/slog"
+	"sync"
+
+	"gophermart/internal/model"
+)
+
+type UserEvent = model.UserEvent
+
+// subscriptionBuffer is a number of events waiting for slow subscriber before it is dropped
+const subscriptionBuffer = 64
+
+type subscription struct {
+	ch     chan UserEvent
+	closed bool
+}
+
+// Broker fans out events to subscriptions of event's user
+type Broker struct {
+	mu   sync.Mutex
+	subs map[int]map[*subscription]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[int]map[*subscription]struct{})}
+}
+
+// Subscribe returns channel of user events and function to cancel subscription.
+// Channel is closed when subscriber doesn't keep up, it should reconnect and resume from the last event.
+func (b *Broker) Subscribe(userID int) (<-chan UserEvent, func()) {
+	sub := &subscription{ch: make(chan UserEvent, subscriptionBuffer)}
+	b.mu.Lock()
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[*subscription]struct{})
+	}
+	b.subs[userID][sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub.ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(userID, sub)
+	}
+}
+
+// remove must be called with mu locked
+func (b *Broker) remove(userID int, sub *subscription) {
+	if !sub.closed {
+		sub.closed = true
+		close(sub.ch)
+	}
+	delete(b.subs[userID], sub)
+	if len(b.subs[userID]) == 0 {
+		delete(b.subs, userID)
+	}
+}
+
+// Publish never blocks
+func (b *Broker) Publish(ev UserEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs[ev.UserID] {
+		select {
+		case sub.ch <- ev:
+		default:
+			slog.Warn("slow event subscriber dropped", slog.Int("user_id", ev.UserID))
+			b.remove(ev.UserID, sub)
+		}
+	}
+}
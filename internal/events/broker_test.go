@@ -0,0 +1,45 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+	ch1, cancel1 := b.Subscribe(1)
+	ch2, cancel2 := b.Subscribe(2)
+	defer cancel2()
+
+	b.Publish(UserEvent{ID: 1, UserID: 1})
+	b.Publish(UserEvent{ID: 2, UserID: 2})
+
+	if ev := <-ch1; ev.ID != 1 {
+		t.Errorf("user 1 got event %d, want 1", ev.ID)
+	}
+	if ev := <-ch2; ev.ID != 2 {
+		t.Errorf("user 2 got event %d, want 2", ev.ID)
+	}
+
+	cancel1()
+	if _, ok := <-ch1; ok {
+		t.Error("channel should be closed after cancel")
+	}
+	cancel1() // second cancel is harmless
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	b := NewBroker()
+	ch, cancel := b.Subscribe(1)
+	defer cancel()
+
+	for i := 0; i <= subscriptionBuffer; i++ {
+		b.Publish(UserEvent{ID: int64(i), UserID: 1})
+	}
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != subscriptionBuffer {
+		t.Errorf("got %d events before drop, want %d", n, subscriptionBuffer)
+	}
+}
@@ -0,0 +1,66 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Store keeps user events for replay by Last-Event-ID
+type Store interface {
+	// PruneUserEvents deletes at most limit events created before the time, from oldest
+	PruneUserEvents(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// Pruner deletes events older than retention. Client resuming after a longer break
+// receives only the events which are left, the current state is available from the API.
+type Pruner struct {
+	store     Store
+	retention time.Duration
+	batchSize int
+	now       func() time.Time
+}
+
+func NewPruner(store Store, retention time.Duration, batchSize int) *Pruner {
+	return &Pruner{
+		store:     store,
+		retention: retention,
+		batchSize: batchSize,
+		now:       time.Now,
+	}
+}
+
+// Run prunes events every interval until ctx is done
+func (p *Pruner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.prune(ctx)
+		}
+	}
+}
+
+func (p *Pruner) prune(ctx context.Context) {
+	before := p.now().Add(-p.retention)
+	var total int64
+	// удаляем пачками, чтобы не держать долгую транзакцию на большой таблице
+	for ctx.Err() == nil {
+		n, err := p.store.PruneUserEvents(ctx, before, p.batchSize)
+		if err != nil {
+			slog.Error(fmt.Sprintf("prune user events: %s", err))
+			break
+		}
+		total += n
+		if n < int64(p.batchSize) {
+			break
+		}
+	}
+	if total > 0 {
+		slog.Info("user events pruned", slog.Int64("count", total), slog.Time("before", before))
+	}
+}
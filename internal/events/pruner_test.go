@@ -0,0 +1,55 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestPruner_prune(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	before := now.Add(-24 * time.Hour)
+	tests := []struct {
+		name   string
+		expect func(m *MockStore)
+	}{
+		{
+			name: "until_batch_is_not_full",
+			expect: func(m *MockStore) {
+				gomock.InOrder(
+					m.EXPECT().PruneUserEvents(gomock.Any(), before, 2).Return(int64(2), nil),
+					m.EXPECT().PruneUserEvents(gomock.Any(), before, 2).Return(int64(1), nil),
+				)
+			},
+		},
+		{
+			name: "nothing_to_prune",
+			expect: func(m *MockStore) {
+				m.EXPECT().PruneUserEvents(gomock.Any(), before, 2).Return(int64(0), nil)
+			},
+		},
+		{
+			name: "stop_on_error",
+			expect: func(m *MockStore) {
+				gomock.InOrder(
+					m.EXPECT().PruneUserEvents(gomock.Any(), before, 2).Return(int64(2), nil),
+					m.EXPECT().PruneUserEvents(gomock.Any(), before, 2).Return(int64(0), errors.New("connection reset")),
+				)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			m := NewMockStore(ctrl)
+			tt.expect(m)
+
+			p := NewPruner(m, 24*time.Hour, 2)
+			p.now = func() time.Time { return now }
+			p.prune(context.Background())
+		})
+	}
+}
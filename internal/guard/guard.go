@@ -0,0 +1,205 @@
+// Package guard protects login endpoint from password brute-force
+package guard
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"gophermart/internal/logging"
+	"gophermart/internal/model"
+)
+
+type LoginAttempts = model.LoginAttempts
+type AuditRecord = model.AuditRecord
+
+// Store keeps failed login counters. Postgres implementation shares counters between replicas.
+type Store interface {
+	ReserveLogin(ctx context.Context, key string, at, stale time.Time) (LoginAttempts, error)
+	ReleaseLogin(ctx context.Context, key string) error
+	LoginFailure(ctx context.Context, key string, at, since time.Time) (LoginAttempts, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+	AddAudit(ctx context.Context, rec AuditRecord) error
+}
+
+// reservationTimeout is the time after which attempt in flight is considered abandoned, e.g. its replica died
+const reservationTimeout = time.Minute
+
+type Policy struct {
+	MaxFailures   int           // failures of one login before it is locked
+	IPMaxFailures int           // failures from one IP before it is locked
+	BaseDelay     time.Duration // delay after first failure, doubled after each next one
+	MaxDelay      time.Duration
+	LockDuration  time.Duration // also the window after which failures are forgotten
+}
+
+type Guard struct {
+	store    Store
+	fallback *MemoryStore
+	// политика меняется при перезагрузке конфигурации
+	policy atomic.Pointer[Policy]
+	now    func() time.Time
+}
+
+// New creates guard. If store is nil or returns error, in-memory counters are used.
+func New(store Store, policy Policy) *Guard {
+	g := &Guard{
+		store:    store,
+		fallback: NewMemoryStore(),
+		now:      time.Now,
+	}
+	g.SetPolicy(policy)
+	return g
+}
+
+// SetPolicy replaces limits, counters of previous attempts are kept
+func (g *Guard) SetPolicy(policy Policy) {
+	g.policy.Store(&policy)
+}
+
+func loginKey(login string) string {
+	return "login:" + login
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Allow reserves the login attempt and returns zero when it is permitted, otherwise how long the client
+// has to wait. Permitted attempt must be finished with Fail, Succeed or Release.
+// Attempts of the same login or IP in flight are counted as failures, so parallel requests
+// can't check more passwords than the delay allows.
+func (g *Guard) Allow(ctx context.Context, login, ip string) time.Duration {
+	now := g.now()
+	var wait time.Duration
+	for _, key := range []string{loginKey(login), ipKey(ip)} {
+		// counters registered in memory while store was unavailable are taken into account too
+		for _, a := range g.reserve(ctx, key, now) {
+			if d := g.delay(a, now); d > wait {
+				wait = d
+			}
+		}
+	}
+	if wait > 0 {
+		g.Release(ctx, login, ip)
+	}
+	return wait
+}
+
+// Fail registers failed login attempt and locks login or IP if limit is exceeded
+func (g *Guard) Fail(ctx context.Context, login, ip string) {
+	policy := g.policy.Load()
+	g.fail(ctx, loginKey(login), policy.MaxFailures)
+	g.fail(ctx, ipKey(ip), policy.IPMaxFailures)
+}
+
+// Succeed resets failed attempts of the login
+func (g *Guard) Succeed(ctx context.Context, login, ip string) {
+	key := loginKey(login)
+	_ = g.fallback.ResetLoginAttempts(ctx, key)
+	if g.store != nil {
+		if err := g.store.ResetLoginAttempts(ctx, key); err != nil {
+			slog.ErrorContext(ctx, fmt.Sprintf("reset login attempts: %s", err))
+		}
+	}
+	g.release(ctx, ipKey(ip))
+}
+
+// Release finishes the attempt which password was not checked, e.g. because of database error
+func (g *Guard) Release(ctx context.Context, login, ip string) {
+	g.release(ctx, loginKey(login))
+	g.release(ctx, ipKey(ip))
+}
+
+func (g *Guard) delay(a LoginAttempts, now time.Time) time.Duration {
+	if a.LockedUntil.After(now) {
+		return a.LockedUntil.Sub(now)
+	}
+	policy := g.policy.Load()
+	failures, last := a.Failures, a.LastFailure
+	if last.Before(now.Add(-policy.LockDuration)) {
+		failures = 0
+	}
+	// other attempts in flight are counted as failed just now
+	if others := a.InFlight - 1; others > 0 {
+		failures += others
+		last = now
+	}
+	if failures == 0 {
+		return 0
+	}
+	d := policy.BaseDelay
+	for i := 1; i < failures && d < policy.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > policy.MaxDelay {
+		d = policy.MaxDelay
+	}
+	if next := last.Add(d); next.After(now) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+func (g *Guard) reserve(ctx context.Context, key string, now time.Time) []LoginAttempts {
+	stale := now.Add(-reservationTimeout)
+	a, _ := g.fallback.ReserveLogin(ctx, key, now, stale)
+	res := []LoginAttempts{a}
+	if g.store != nil {
+		a, err := g.store.ReserveLogin(ctx, key, now, stale)
+		if err != nil {
+			slog.ErrorContext(ctx, fmt.Sprintf("reserve login attempt: %s", err))
+			return res
+		}
+		res = append(res, a)
+	}
+	return res
+}
+
+func (g *Guard) release(ctx context.Context, key string) {
+	_ = g.fallback.ReleaseLogin(ctx, key)
+	if g.store != nil {
+		if err := g.store.ReleaseLogin(ctx, key); err != nil {
+			slog.ErrorContext(ctx, fmt.Sprintf("release login attempt: %s", err))
+		}
+	}
+}
+
+func (g *Guard) fail(ctx context.Context, key string, limit int) {
+	now := g.now()
+	lockDuration := g.policy.Load().LockDuration
+	since := now.Add(-lockDuration)
+	var st Store = g.fallback
+	if g.store != nil {
+		st = g.store
+	}
+	a, err := st.LoginFailure(ctx, key, now, since)
+	if err != nil {
+		slog.ErrorContext(ctx, fmt.Sprintf("register login failure: %s", err))
+		st = g.fallback
+		a, _ = st.LoginFailure(ctx, key, now, since)
+	} else if st != g.fallback {
+		_ = g.fallback.ReleaseLogin(ctx, key)
+	}
+	if limit <= 0 || a.Failures < limit || a.LockedUntil.After(now) {
+		return
+	}
+	until := now.Add(lockDuration)
+	if err := st.LockLogin(ctx, key, until); err != nil {
+		slog.ErrorContext(ctx, fmt.Sprintf("lock login: %s", err))
+		return
+	}
+	rec := AuditRecord{
+		Action:    "login_locked",
+		Target:    key,
+		Details:   fmt.Sprintf("%d failed attempts, locked until %s", a.Failures, until.Format(time.RFC3339)),
+		CreatedAt: now,
+	}
+	slog.WarnContext(ctx, "login locked", slog.Any("target", logging.PII(rec.Target)), slog.Int("failures", a.Failures))
+	if err := st.AddAudit(ctx, rec); err != nil {
+		slog.ErrorContext(ctx, fmt.Sprintf("audit: %s", err))
+	}
+}
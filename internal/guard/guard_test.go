@@ -0,0 +1,118 @@
+package guard
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type brokenStore struct{}
+
+var errBroken = errors.New("connection refused")
+
+func (brokenStore) ReserveLogin(context.Context, string, time.Time, time.Time) (LoginAttempts, error) {
+	return LoginAttempts{}, errBroken
+}
+func (brokenStore) ReleaseLogin(context.Context, string) error { return errBroken }
+func (brokenStore) LoginFailure(context.Context, string, time.Time, time.Time) (LoginAttempts, error) {
+	return LoginAttempts{}, errBroken
+}
+func (brokenStore) LockLogin(context.Context, string, time.Time) error { return errBroken }
+func (brokenStore) ResetLoginAttempts(context.Context, string) error   { return errBroken }
+func (brokenStore) AddAudit(context.Context, AuditRecord) error        { return errBroken }
+
+var testPolicy = Policy{
+	MaxFailures:   3,
+	IPMaxFailures: 10,
+	BaseDelay:     time.Second,
+	MaxDelay:      4 * time.Second,
+	LockDuration:  time.Minute,
+}
+
+func newTestGuard(store Store) (*Guard, *time.Time) {
+	now := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	g := New(store, testPolicy)
+	g.now = func() time.Time { return now }
+	return g, &now
+}
+
+func TestGuard_ProgressiveDelay(t *testing.T) {
+	ctx := context.Background()
+	g, now := newTestGuard(NewMemoryStore())
+
+	if wait := g.Allow(ctx, "user", "10.0.0.1"); wait != 0 {
+		t.Fatalf("first attempt should be allowed, got wait %v", wait)
+	}
+	g.Fail(ctx, "user", "10.0.0.1")
+	if wait := g.Allow(ctx, "user", "10.0.0.1"); wait != time.Second {
+		t.Errorf("after 1 failure got wait %v, want %v", wait, time.Second)
+	}
+	*now = now.Add(time.Second)
+	g.Fail(ctx, "user", "10.0.0.1")
+	if wait := g.Allow(ctx, "user", "10.0.0.1"); wait != 2*time.Second {
+		t.Errorf("after 2 failures got wait %v, want %v", wait, 2*time.Second)
+	}
+	// another IP is delayed by login counter as well
+	if wait := g.Allow(ctx, "user", "10.0.0.2"); wait != 2*time.Second {
+		t.Errorf("another IP got wait %v, want %v", wait, 2*time.Second)
+	}
+	g.Succeed(ctx, "user", "10.0.0.2")
+	if wait := g.Allow(ctx, "user", "10.0.0.2"); wait != 0 {
+		t.Errorf("after success got wait %v, want 0", wait)
+	}
+}
+
+func TestGuard_LockWithAudit(t *testing.T) {
+	ctx := context.Background()
+	st := NewMemoryStore()
+	g, now := newTestGuard(st)
+
+	for i := 0; i < testPolicy.MaxFailures; i++ {
+		g.Fail(ctx, "user", "10.0.0.1")
+		*now = now.Add(5 * time.Second)
+	}
+	wait := g.Allow(ctx, "user", "10.0.0.1")
+	if wait <= testPolicy.MaxDelay || wait > testPolicy.LockDuration {
+		t.Errorf("locked login got wait %v", wait)
+	}
+	if len(st.audit) != 1 || st.audit[0].Action != "login_locked" || st.audit[0].Target != "login:user" {
+		t.Errorf("unexpected audit records: %+v", st.audit)
+	}
+	*now = now.Add(testPolicy.LockDuration)
+	if wait := g.Allow(ctx, "user", "10.0.0.1"); wait != 0 {
+		t.Errorf("after lock expired got wait %v, want 0", wait)
+	}
+}
+
+func TestGuard_ParallelAttempts(t *testing.T) {
+	ctx := context.Background()
+	g, now := newTestGuard(NewMemoryStore())
+
+	if wait := g.Allow(ctx, "user", "10.0.0.1"); wait != 0 {
+		t.Fatalf("first attempt should be allowed, got wait %v", wait)
+	}
+	// password of the first attempt is still checked
+	if wait := g.Allow(ctx, "user", "10.0.0.2"); wait != time.Second {
+		t.Errorf("parallel attempt got wait %v, want %v", wait, time.Second)
+	}
+	g.Release(ctx, "user", "10.0.0.1")
+	if wait := g.Allow(ctx, "user", "10.0.0.2"); wait != 0 {
+		t.Errorf("after release got wait %v, want 0", wait)
+	}
+	// reservation of died replica is forgotten
+	*now = now.Add(reservationTimeout + time.Second)
+	if wait := g.Allow(ctx, "user", "10.0.0.3"); wait != 0 {
+		t.Errorf("after reservation timeout got wait %v, want 0", wait)
+	}
+}
+
+func TestGuard_Fallback(t *testing.T) {
+	ctx := context.Background()
+	g, _ := newTestGuard(brokenStore{})
+
+	g.Fail(ctx, "user", "10.0.0.1")
+	if wait := g.Allow(ctx, "user", "10.0.0.1"); wait != time.Second {
+		t.Errorf("fallback counter got wait %v, want %v", wait, time.Second)
+	}
+}
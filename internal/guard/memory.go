@@ -0,0 +1,107 @@
+package guard
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps counters in process memory. It is used when there is no shared store
+// or it is temporarily unavailable.
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]LoginAttempts
+	// время последнего резерва попытки по ключу
+	reserved map[string]time.Time
+	audit    []AuditRecord
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		attempts: make(map[string]LoginAttempts),
+		reserved: make(map[string]time.Time),
+	}
+}
+
+// memoryStoreCleanup is the number of keys after which forgotten counters are purged
+const memoryStoreCleanup = 10_000
+
+func (m *MemoryStore) LoginFailure(_ context.Context, key string, at, since time.Time) (LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.attempts) >= memoryStoreCleanup {
+		for k, a := range m.attempts {
+			if a.LastFailure.Before(since) && a.LockedUntil.Before(at) && a.InFlight == 0 {
+				delete(m.attempts, k)
+				delete(m.reserved, k)
+			}
+		}
+	}
+	a := m.attempts[key]
+	if a.LastFailure.Before(since) {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailure = at
+	if a.InFlight > 0 {
+		a.InFlight--
+	}
+	m.attempts[key] = a
+	return a, nil
+}
+
+func (m *MemoryStore) ReserveLogin(_ context.Context, key string, at, stale time.Time) (LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a := m.attempts[key]
+	if m.reserved[key].Before(stale) {
+		a.InFlight = 0
+	}
+	a.InFlight++
+	m.attempts[key] = a
+	m.reserved[key] = at
+	return a, nil
+}
+
+func (m *MemoryStore) ReleaseLogin(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.attempts[key]
+	if !ok {
+		return nil
+	}
+	if a.InFlight > 0 {
+		a.InFlight--
+	}
+	m.attempts[key] = a
+	// ключи без неудачных попыток не копятся
+	if a == (LoginAttempts{}) {
+		delete(m.attempts, key)
+		delete(m.reserved, key)
+	}
+	return nil
+}
+
+func (m *MemoryStore) LockLogin(_ context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a := m.attempts[key]
+	a.LockedUntil = until
+	m.attempts[key] = a
+	return nil
+}
+
+func (m *MemoryStore) ResetLoginAttempts(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attempts, key)
+	delete(m.reserved, key)
+	return nil
+}
+
+func (m *MemoryStore) AddAudit(_ context.Context, rec AuditRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.audit = append(m.audit, rec)
+	return nil
+}
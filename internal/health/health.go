@@ -0,0 +1,109 @@
+// Package health runs readiness checks for orchestrator probes
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded" // instance works, but some dependency is unhealthy
+	StatusFailed   Status = "failed"
+	StatusDraining Status = "draining" // graceful shutdown started
+)
+
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name string
+	fn   CheckFunc
+	// отказ проверки не снимает экземпляр с балансировки
+	degrades bool
+}
+
+// CheckResult is a result of one check
+type CheckResult struct {
+	Status Status `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is overall readiness with results of all checks
+type Report struct {
+	Status Status                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Ready is true when instance may receive traffic
+func (r Report) Ready() bool {
+	return r.Status == StatusOK || r.Status == StatusDegraded
+}
+
+type Checker struct {
+	checks   []check
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+// New creates checker, every check is limited by timeout
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers check which failure makes instance not ready
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// AddDegraded registers check which failure is only reported as degraded
+func (c *Checker) AddDegraded(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn, degrades: true})
+}
+
+// Drain makes instance not ready, it's called at start of graceful shutdown
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Check runs all checks concurrently
+func (c *Checker) Check(ctx context.Context) Report {
+	if c.draining.Load() {
+		return Report{Status: StatusDraining}
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, ch := range c.checks {
+		wg.Add(1)
+		go func(i int, ch check) {
+			defer wg.Done()
+			results[i] = CheckResult{Status: StatusOK}
+			if err := ch.fn(ctx); err != nil {
+				results[i].Status = StatusFailed
+				if ch.degrades {
+					results[i].Status = StatusDegraded
+				}
+				results[i].Error = err.Error()
+			}
+		}(i, ch)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(c.checks))}
+	for i, ch := range c.checks {
+		report.Checks[ch.name] = results[i]
+		switch {
+		case results[i].Status == StatusFailed:
+			report.Status = StatusFailed
+		case results[i].Status == StatusDegraded && report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
@@ -0,0 +1,74 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChecker_Check(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	fail := func(context.Context) error { return errors.New("connection refused") }
+	tests := []struct {
+		name   string
+		setup  func(c *Checker)
+		status Status
+		ready  bool
+	}{
+		{
+			name: "all_ok",
+			setup: func(c *Checker) {
+				c.Add("postgres", ok)
+				c.AddDegraded("accrual", ok)
+			},
+			status: StatusOK,
+			ready:  true,
+		},
+		{
+			name: "degraded_dependency_keeps_ready",
+			setup: func(c *Checker) {
+				c.Add("postgres", ok)
+				c.AddDegraded("accrual", fail)
+			},
+			status: StatusDegraded,
+			ready:  true,
+		},
+		{
+			name: "failed_check",
+			setup: func(c *Checker) {
+				c.Add("postgres", fail)
+				c.AddDegraded("accrual", fail)
+			},
+			status: StatusFailed,
+		},
+		{
+			name: "draining",
+			setup: func(c *Checker) {
+				c.Add("postgres", ok)
+				c.Drain()
+			},
+			status: StatusDraining,
+		},
+		{
+			name: "check_timeout",
+			setup: func(c *Checker) {
+				c.Add("postgres", func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				})
+			},
+			status: StatusFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(50 * time.Millisecond)
+			tt.setup(c)
+			report := c.Check(context.Background())
+			if report.Status != tt.status || report.Ready() != tt.ready {
+				t.Errorf("got %+v, want status %s ready %v", report, tt.status, tt.ready)
+			}
+		})
+	}
+}
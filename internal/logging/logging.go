@@ -0,0 +1,66 @@
+// Package logging adds request attributes from context to slog records
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Fields identify request that caused log line, they outlive the request in background tasks
+type Fields struct {
+	RequestID string
+	UserID    int
+}
+
+type fieldsCtxKey struct{}
+
+// FromContext returns fields of ctx, zero Fields if there are none
+func FromContext(ctx context.Context) Fields {
+	f, _ := ctx.Value(fieldsCtxKey{}).(Fields)
+	return f
+}
+
+// WithFields stores fields in ctx, e.g. to continue request logging in pollster task
+func WithFields(ctx context.Context, f Fields) context.Context {
+	return context.WithValue(ctx, fieldsCtxKey{}, f)
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	f := FromContext(ctx)
+	f.RequestID = id
+	return WithFields(ctx, f)
+}
+
+func WithUserID(ctx context.Context, id int) context.Context {
+	f := FromContext(ctx)
+	f.UserID = id
+	return WithFields(ctx, f)
+}
+
+// Handler adds request_id and user_id to records logged with context, e.g. slog.InfoContext
+type Handler struct {
+	slog.Handler
+}
+
+func NewHandler(h slog.Handler) *Handler {
+	return &Handler{Handler: h}
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	f := FromContext(ctx)
+	if f.RequestID != "" {
+		r.AddAttrs(slog.String("request_id", f.RequestID))
+	}
+	if f.UserID != 0 {
+		r.AddAttrs(slog.Int("user_id", f.UserID))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,29 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(NewHandler(slog.NewTextHandler(&buf, nil))).With("component", "pollster")
+
+	ctx := WithUserID(WithRequestID(context.Background(), "req-1"), 42)
+	log.InfoContext(ctx, "order polled")
+	log.Info("without context")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	if !strings.Contains(lines[0], "component=pollster request_id=req-1 user_id=42") {
+		t.Errorf("request attributes are missing: %s", lines[0])
+	}
+	if strings.Contains(lines[1], "request_id") {
+		t.Errorf("line without context has request attributes: %s", lines[1])
+	}
+}
@@ -0,0 +1,227 @@
+package logging
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+// Mask replaces redacted values
+const Mask = "***"
+
+// piiHashLen is length of PII hash in bytes, 8 bytes make collisions unlikely for millions of users
+const piiHashLen = 8
+
+// DefaultRedactKeys are patterns of attribute keys, query parameters, headers and JSON fields
+// which values are never logged. Patterns use path.Match syntax and are matched against
+// lower-cased key with '-' replaced by '_'.
+var DefaultRedactKeys = []string{
+	"password", "*_password",
+	"token", "*_token",
+	"authorization", "proxy_authorization",
+	"cookie", "set_cookie",
+	"secret", "*_secret",
+	"*api_key",
+	"login", "email", "phone",
+}
+
+// Redactor masks values by key rules, see DefaultRedactKeys
+type Redactor struct {
+	rules []string
+}
+
+// NewRedactor fails on malformed pattern
+func NewRedactor(rules []string) (*Redactor, error) {
+	r := &Redactor{rules: make([]string, 0, len(rules))}
+	for _, rule := range rules {
+		rule = normalizeKey(rule)
+		if _, err := path.Match(rule, ""); err != nil {
+			return nil, fmt.Errorf("invalid redact rule %q: %w", rule, err)
+		}
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
+func normalizeKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "-", "_")
+}
+
+// Match reports whether value of key must be masked
+func (r *Redactor) Match(key string) bool {
+	key = normalizeKey(key)
+	for _, rule := range r.rules {
+		if ok, _ := path.Match(rule, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplaceAttr is for slog.HandlerOptions, it masks attributes by key
+// and redacts headers, query values and URLs logged without wrappers
+func (r *Redactor) ReplaceAttr(_ []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		return a
+	}
+	if r.Match(a.Key) {
+		return slog.String(a.Key, Mask)
+	}
+	if a.Value.Kind() != slog.KindAny {
+		return a
+	}
+	switch v := a.Value.Any().(type) {
+	case http.Header:
+		return slog.Any(a.Key, r.header(v))
+	case url.Values:
+		return slog.String(a.Key, r.query(v).Encode())
+	case *url.URL:
+		return slog.String(a.Key, r.url(v))
+	}
+	return a
+}
+
+func (r *Redactor) header(h http.Header) map[string][]string {
+	res := make(map[string][]string, len(h))
+	for k, v := range h {
+		if r.Match(k) {
+			v = []string{Mask}
+		}
+		res[k] = v
+	}
+	return res
+}
+
+func (r *Redactor) query(q url.Values) url.Values {
+	res := make(url.Values, len(q))
+	for k, v := range q {
+		if r.Match(k) {
+			v = []string{Mask}
+		}
+		res[k] = v
+	}
+	return res
+}
+
+func (r *Redactor) url(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	c := *u
+	if c.User != nil {
+		c.User = url.User(c.User.Username())
+	}
+	if c.RawQuery != "" {
+		c.RawQuery = r.query(c.Query()).Encode()
+	}
+	return c.String()
+}
+
+func (r *Redactor) json(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, fv := range v {
+			if r.Match(k) {
+				v[k] = Mask
+			} else {
+				v[k] = r.json(fv)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = r.json(v[i])
+		}
+	}
+	return v
+}
+
+var active atomic.Pointer[Redactor]
+
+var piiKey atomic.Pointer[[]byte]
+
+func init() {
+	r, _ := NewRedactor(DefaultRedactKeys)
+	SetRedactor(r)
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	SetPIIKey(key)
+}
+
+// SetRedactor sets rules used by typed wrappers, it's called once on logger setup
+func SetRedactor(r *Redactor) {
+	active.Store(r)
+}
+
+// SetPIIKey sets key of PII hashes. Without it the key is random and hashes
+// can be correlated only within one process
+func SetPIIKey(key []byte) {
+	if len(key) == 0 {
+		return
+	}
+	key = append([]byte(nil), key...)
+	piiKey.Store(&key)
+}
+
+// Secret is never logged or printed
+type Secret string
+
+func (Secret) LogValue() slog.Value { return slog.StringValue(Mask) }
+
+func (Secret) String() string { return Mask }
+
+// PII is replaced by keyed hash, so lines of the same person can still be correlated,
+// but the value can't be found by hashing candidates without the key
+type PII string
+
+func (p PII) LogValue() slog.Value { return slog.StringValue(p.String()) }
+
+func (p PII) String() string {
+	if p == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, *piiKey.Load())
+	mac.Write([]byte(p))
+	return "pii:" + hex.EncodeToString(mac.Sum(nil)[:piiHashLen])
+}
+
+type urlValue struct{ u *url.URL }
+
+// URL logs u with redacted query parameters and without password
+func URL(u *url.URL) slog.LogValuer { return urlValue{u} }
+
+func (v urlValue) LogValue() slog.Value { return slog.StringValue(active.Load().url(v.u)) }
+
+type headerValue struct{ h http.Header }
+
+// Header logs h with redacted values, e.g. Authorization
+func Header(h http.Header) slog.LogValuer { return headerValue{h} }
+
+func (v headerValue) LogValue() slog.Value { return slog.AnyValue(active.Load().header(v.h)) }
+
+type jsonValue struct{ body []byte }
+
+// JSON logs body with redacted fields, body that isn't JSON is logged only by size
+func JSON(body []byte) slog.LogValuer { return jsonValue{body} }
+
+func (v jsonValue) LogValue() slog.Value {
+	var doc any
+	if err := json.Unmarshal(v.body, &doc); err != nil {
+		return slog.StringValue(fmt.Sprintf("<%d bytes, not JSON>", len(v.body)))
+	}
+	res, err := json.Marshal(active.Load().json(doc))
+	if err != nil {
+		return slog.StringValue(fmt.Sprintf("<%d bytes>", len(v.body)))
+	}
+	return slog.StringValue(string(res))
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Sampler passes first n lines in every period and drops the rest,
+// it's for high-volume debug lines that are useless at full rate
+type Sampler struct {
+	n       int
+	period  time.Duration
+	mu      sync.Mutex
+	start   time.Time
+	passed  int
+	dropped int
+	now     func() time.Time
+}
+
+func NewSampler(n int, period time.Duration) *Sampler {
+	return &Sampler{n: n, period: period, now: time.Now}
+}
+
+// Sample checks level of default logger first, so disabled lines don't use up the budget
+func (s *Sampler) Sample(ctx context.Context, level slog.Level) (bool, int) {
+	if !slog.Default().Enabled(ctx, level) {
+		return false, 0
+	}
+	return s.Allow()
+}
+
+// Allow reports whether line may be logged and how many lines were dropped before it
+func (s *Sampler) Allow() (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.Sub(s.start) >= s.period {
+		s.start = now
+		s.passed = 0
+	}
+	if s.passed >= s.n {
+		s.dropped++
+		return false, 0
+	}
+	s.passed++
+	dropped := s.dropped
+	s.dropped = 0
+	return true, dropped
+}
@@ -0,0 +1,32 @@
+package logging
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSampler(t *testing.T) {
+	now := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	s := NewSampler(2, time.Minute)
+	s.now = func() time.Time { return now }
+
+	steps := []struct {
+		advance time.Duration
+		ok      bool
+		dropped int
+	}{
+		{ok: true},
+		{advance: time.Second, ok: true},
+		{advance: time.Second},
+		{advance: time.Second},
+		{advance: time.Minute, ok: true, dropped: 2},
+		{advance: time.Second, ok: true},
+	}
+	for i, step := range steps {
+		now = now.Add(step.advance)
+		ok, dropped := s.Allow()
+		if ok != step.ok || dropped != step.dropped {
+			t.Errorf("step %d: got (%v, %d), want (%v, %d)", i, ok, dropped, step.ok, step.dropped)
+		}
+	}
+}
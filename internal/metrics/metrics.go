@@ -0,0 +1,111 @@
+// Package metrics registers counters, gauges and histograms in Prometheus client registry.
+// Collectors keep the small API used across the service: label values are passed to Add and Observe.
+// OpenTelemetry is used for traces only, see package tracing.
+package metrics
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+// DefBuckets are latency buckets in seconds
+var DefBuckets = prometheus.DefBuckets
+
+// Registry wraps Prometheus registry, duplicate metric names panic on registration
+type Registry struct {
+	reg *prometheus.Registry
+}
+
+// Default is used by package level constructors
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{reg: prometheus.NewRegistry()}
+}
+
+// Write writes all metrics in text exposition format sorted by name
+func (r *Registry) Write(w io.Writer) error {
+	families, err := r.reg.Gather()
+	if err != nil {
+		return err
+	}
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves metrics for Prometheus scraper
+func (r *Registry) Handler() http.Handler {
+	return promhttp.HandlerFor(r.reg, promhttp.HandlerOpts{})
+}
+
+// CounterVec is a monotonically increasing value per combination of labels
+type CounterVec struct {
+	vec *prometheus.CounterVec
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	r.reg.MustRegister(vec)
+	return &CounterVec{vec: vec}
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// Add increases counter, negative values are ignored
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.vec.WithLabelValues(labelValues...).Add(v)
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// HistogramVec counts observations in cumulative buckets per combination of labels
+type HistogramVec struct {
+	vec *prometheus.HistogramVec
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)
+	r.reg.MustRegister(vec)
+	return &HistogramVec{vec: vec}
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.vec.WithLabelValues(labelValues...).Observe(v)
+}
+
+// NewGaugeFunc registers gauge which value is returned by fn on every scrape, e.g. from connection pool stats
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, fn))
+}
+
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.NewGaugeFunc(name, help, fn)
+}
+
+// NewCounterFunc registers counter maintained elsewhere, fn must never decrease
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.reg.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, fn))
+}
+
+func NewCounterFunc(name, help string, fn func() float64) {
+	Default.NewCounterFunc(name, help, fn)
+}
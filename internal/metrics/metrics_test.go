@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("http_requests_total", "Requests.", "route", "status")
+	latency := r.NewHistogramVec("http_request_duration_seconds", "Latency.", []float64{0.1, 1}, "route")
+	r.NewGaugeFunc("rate_limit", "Current limit.", func() float64 { return math.Inf(1) })
+
+	requests.Inc("GET /api/user/orders", "200")
+	requests.Add(2, "GET /api/user/orders", "200")
+	requests.Inc(`GET /a"b`, "500")
+	latency.Observe(0.05, "GET /api/user/orders")
+	latency.Observe(0.1, "GET /api/user/orders")
+	latency.Observe(3, "GET /api/user/orders")
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP http_request_duration_seconds Latency.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{route="GET /api/user/orders",le="0.1"} 2
+http_request_duration_seconds_bucket{route="GET /api/user/orders",le="1"} 2
+http_request_duration_seconds_bucket{route="GET /api/user/orders",le="+Inf"} 3
+http_request_duration_seconds_sum{route="GET /api/user/orders"} 3.15
+http_request_duration_seconds_count{route="GET /api/user/orders"} 3
+# HELP http_requests_total Requests.
+# TYPE http_requests_total counter
+http_requests_total{route="GET /a\"b",status="500"} 1
+http_requests_total{route="GET /api/user/orders",status="200"} 3
+# HELP rate_limit Current limit.
+# TYPE rate_limit gauge
+rate_limit +Inf
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegistry_Duplicate(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("events_total", "Events.")
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate metric must panic")
+		}
+	}()
+	r.NewCounterVec("events_total", "Events.")
+}
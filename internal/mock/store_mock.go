@@ -8,6 +8,7 @@ import (
 	context "context"
 	model "gophermart/internal/model"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -35,19 +36,63 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
+// AddAudit mocks base method.
+func (m *MockStore) AddAudit(arg0 context.Context, arg1 model.AuditRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddAudit", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddAudit indicates an expected call of AddAudit.
+func (mr *MockStoreMockRecorder) AddAudit(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAudit", reflect.TypeOf((*MockStore)(nil).AddAudit), arg0, arg1)
+}
+
+// AddMerchantKey mocks base method.
+func (m *MockStore) AddMerchantKey(arg0 context.Context, arg1 model.MerchantKey, arg2 model.AuditRecord) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddMerchantKey", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddMerchantKey indicates an expected call of AddMerchantKey.
+func (mr *MockStoreMockRecorder) AddMerchantKey(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddMerchantKey", reflect.TypeOf((*MockStore)(nil).AddMerchantKey), arg0, arg1, arg2)
+}
+
 // AddOrder mocks base method.
-func (m *MockStore) AddOrder(arg0 context.Context, arg1, arg2 int) (model.OrderStatus, error) {
+func (m *MockStore) AddOrder(arg0 context.Context, arg1, arg2, arg3 int) (model.OrderStatus, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddOrder", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "AddOrder", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(model.OrderStatus)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AddOrder indicates an expected call of AddOrder.
-func (mr *MockStoreMockRecorder) AddOrder(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) AddOrder(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddOrder", reflect.TypeOf((*MockStore)(nil).AddOrder), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddOrder", reflect.TypeOf((*MockStore)(nil).AddOrder), arg0, arg1, arg2, arg3)
+}
+
+// AddOrders mocks base method.
+func (m *MockStore) AddOrders(arg0 context.Context, arg1 []int, arg2 int) ([]model.OrderUpload, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddOrders", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]model.OrderUpload)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddOrders indicates an expected call of AddOrders.
+func (mr *MockStoreMockRecorder) AddOrders(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddOrders", reflect.TypeOf((*MockStore)(nil).AddOrders), arg0, arg1, arg2)
 }
 
 // AddUser mocks base method.
@@ -65,6 +110,50 @@ func (mr *MockStoreMockRecorder) AddUser(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUser", reflect.TypeOf((*MockStore)(nil).AddUser), arg0, arg1)
 }
 
+// AddWebhook mocks base method.
+func (m *MockStore) AddWebhook(arg0 context.Context, arg1 model.Webhook) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddWebhook", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddWebhook indicates an expected call of AddWebhook.
+func (mr *MockStoreMockRecorder) AddWebhook(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddWebhook", reflect.TypeOf((*MockStore)(nil).AddWebhook), arg0, arg1)
+}
+
+// AdjustBalance mocks base method.
+func (m *MockStore) AdjustBalance(arg0 context.Context, arg1 int, arg2 model.Adjustment) (model.Adjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AdjustBalance", arg0, arg1, arg2)
+	ret0, _ := ret[0].(model.Adjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AdjustBalance indicates an expected call of AdjustBalance.
+func (mr *MockStoreMockRecorder) AdjustBalance(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdjustBalance", reflect.TypeOf((*MockStore)(nil).AdjustBalance), arg0, arg1, arg2)
+}
+
+// DeleteWebhook mocks base method.
+func (m *MockStore) DeleteWebhook(arg0 context.Context, arg1 model.WebhookOwner, arg2 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWebhook indicates an expected call of DeleteWebhook.
+func (mr *MockStoreMockRecorder) DeleteWebhook(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockStore)(nil).DeleteWebhook), arg0, arg1, arg2)
+}
+
 // GetBalance mocks base method.
 func (m *MockStore) GetBalance(arg0 context.Context, arg1 int) (*model.Balance, error) {
 	m.ctrl.T.Helper()
@@ -80,6 +169,51 @@ func (mr *MockStoreMockRecorder) GetBalance(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalance", reflect.TypeOf((*MockStore)(nil).GetBalance), arg0, arg1)
 }
 
+// GetMerchantKey mocks base method.
+func (m *MockStore) GetMerchantKey(arg0 context.Context, arg1 []byte) (*model.MerchantKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMerchantKey", arg0, arg1)
+	ret0, _ := ret[0].(*model.MerchantKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMerchantKey indicates an expected call of GetMerchantKey.
+func (mr *MockStoreMockRecorder) GetMerchantKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMerchantKey", reflect.TypeOf((*MockStore)(nil).GetMerchantKey), arg0, arg1)
+}
+
+// GetOrder mocks base method.
+func (m *MockStore) GetOrder(arg0 context.Context, arg1 int) (*model.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrder", arg0, arg1)
+	ret0, _ := ret[0].(*model.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrder indicates an expected call of GetOrder.
+func (mr *MockStoreMockRecorder) GetOrder(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrder", reflect.TypeOf((*MockStore)(nil).GetOrder), arg0, arg1)
+}
+
+// GetOrderHistory mocks base method.
+func (m *MockStore) GetOrderHistory(arg0 context.Context, arg1 int) ([]model.OrderStatusEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrderHistory", arg0, arg1)
+	ret0, _ := ret[0].([]model.OrderStatusEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrderHistory indicates an expected call of GetOrderHistory.
+func (mr *MockStoreMockRecorder) GetOrderHistory(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderHistory", reflect.TypeOf((*MockStore)(nil).GetOrderHistory), arg0, arg1)
+}
+
 // GetUser mocks base method.
 func (m *MockStore) GetUser(arg0 context.Context, arg1 string) (*model.User, error) {
 	m.ctrl.T.Helper()
@@ -95,6 +229,36 @@ func (mr *MockStoreMockRecorder) GetUser(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockStore)(nil).GetUser), arg0, arg1)
 }
 
+// ListAdjustments mocks base method.
+func (m *MockStore) ListAdjustments(arg0 context.Context, arg1 int) ([]model.Adjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAdjustments", arg0, arg1)
+	ret0, _ := ret[0].([]model.Adjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAdjustments indicates an expected call of ListAdjustments.
+func (mr *MockStoreMockRecorder) ListAdjustments(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAdjustments", reflect.TypeOf((*MockStore)(nil).ListAdjustments), arg0, arg1)
+}
+
+// ListMerchantKeys mocks base method.
+func (m *MockStore) ListMerchantKeys(arg0 context.Context) ([]model.MerchantKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMerchantKeys", arg0)
+	ret0, _ := ret[0].([]model.MerchantKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMerchantKeys indicates an expected call of ListMerchantKeys.
+func (mr *MockStoreMockRecorder) ListMerchantKeys(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMerchantKeys", reflect.TypeOf((*MockStore)(nil).ListMerchantKeys), arg0)
+}
+
 // ListOrders mocks base method.
 func (m *MockStore) ListOrders(arg0 context.Context, arg1 int) ([]model.Order, error) {
 	m.ctrl.T.Helper()
@@ -110,6 +274,123 @@ func (mr *MockStoreMockRecorder) ListOrders(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListOrders", reflect.TypeOf((*MockStore)(nil).ListOrders), arg0, arg1)
 }
 
+// ListOrdersPage mocks base method.
+func (m *MockStore) ListOrdersPage(arg0 context.Context, arg1 int, arg2 model.OrderFilter) ([]model.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListOrdersPage", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]model.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListOrdersPage indicates an expected call of ListOrdersPage.
+func (mr *MockStoreMockRecorder) ListOrdersPage(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListOrdersPage", reflect.TypeOf((*MockStore)(nil).ListOrdersPage), arg0, arg1, arg2)
+}
+
+// ListUserEvents mocks base method.
+func (m *MockStore) ListUserEvents(arg0 context.Context, arg1 int, arg2 int64, arg3 int) ([]model.UserEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUserEvents", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]model.UserEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUserEvents indicates an expected call of ListUserEvents.
+func (mr *MockStoreMockRecorder) ListUserEvents(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUserEvents", reflect.TypeOf((*MockStore)(nil).ListUserEvents), arg0, arg1, arg2, arg3)
+}
+
+// ListWebhookDeliveries mocks base method.
+func (m *MockStore) ListWebhookDeliveries(arg0 context.Context, arg1 model.WebhookOwner, arg2, arg3 int) ([]model.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListWebhookDeliveries", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]model.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListWebhookDeliveries indicates an expected call of ListWebhookDeliveries.
+func (mr *MockStoreMockRecorder) ListWebhookDeliveries(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListWebhookDeliveries", reflect.TypeOf((*MockStore)(nil).ListWebhookDeliveries), arg0, arg1, arg2, arg3)
+}
+
+// ListWebhooks mocks base method.
+func (m *MockStore) ListWebhooks(arg0 context.Context, arg1 model.WebhookOwner) ([]model.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListWebhooks", arg0, arg1)
+	ret0, _ := ret[0].([]model.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListWebhooks indicates an expected call of ListWebhooks.
+func (mr *MockStoreMockRecorder) ListWebhooks(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListWebhooks", reflect.TypeOf((*MockStore)(nil).ListWebhooks), arg0, arg1)
+}
+
+// RedeliverWebhook mocks base method.
+func (m *MockStore) RedeliverWebhook(arg0 context.Context, arg1 model.WebhookOwner, arg2 int, arg3 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RedeliverWebhook", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RedeliverWebhook indicates an expected call of RedeliverWebhook.
+func (mr *MockStoreMockRecorder) RedeliverWebhook(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RedeliverWebhook", reflect.TypeOf((*MockStore)(nil).RedeliverWebhook), arg0, arg1, arg2, arg3)
+}
+
+// RevokeMerchantKey mocks base method.
+func (m *MockStore) RevokeMerchantKey(arg0 context.Context, arg1 int, arg2 model.AuditRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeMerchantKey", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeMerchantKey indicates an expected call of RevokeMerchantKey.
+func (mr *MockStoreMockRecorder) RevokeMerchantKey(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeMerchantKey", reflect.TypeOf((*MockStore)(nil).RevokeMerchantKey), arg0, arg1, arg2)
+}
+
+// SearchUsers mocks base method.
+func (m *MockStore) SearchUsers(arg0 context.Context, arg1 string, arg2 int) ([]model.UserInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchUsers", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]model.UserInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchUsers indicates an expected call of SearchUsers.
+func (mr *MockStoreMockRecorder) SearchUsers(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchUsers", reflect.TypeOf((*MockStore)(nil).SearchUsers), arg0, arg1, arg2)
+}
+
+// SetBlocked mocks base method.
+func (m *MockStore) SetBlocked(arg0 context.Context, arg1 int, arg2 bool, arg3 model.AuditRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetBlocked", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetBlocked indicates an expected call of SetBlocked.
+func (mr *MockStoreMockRecorder) SetBlocked(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBlocked", reflect.TypeOf((*MockStore)(nil).SetBlocked), arg0, arg1, arg2, arg3)
+}
+
 // SpendBonus mocks base method.
 func (m *MockStore) SpendBonus(arg0 context.Context, arg1 int, arg2 model.Payment) error {
 	m.ctrl.T.Helper()
@@ -138,3 +419,49 @@ func (mr *MockStoreMockRecorder) SpentBonusList(arg0, arg1 interface{}) *gomock.
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SpentBonusList", reflect.TypeOf((*MockStore)(nil).SpentBonusList), arg0, arg1)
 }
+
+// SpentBonusPage mocks base method.
+func (m *MockStore) SpentBonusPage(arg0 context.Context, arg1 int, arg2 model.PaymentFilter) ([]model.PaymentFact, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SpentBonusPage", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]model.PaymentFact)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SpentBonusPage indicates an expected call of SpentBonusPage.
+func (mr *MockStoreMockRecorder) SpentBonusPage(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SpentBonusPage", reflect.TypeOf((*MockStore)(nil).SpentBonusPage), arg0, arg1, arg2)
+}
+
+// SpentBonusSummary mocks base method.
+func (m *MockStore) SpentBonusSummary(arg0 context.Context, arg1 int, arg2, arg3 time.Time) (model.WithdrawalSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SpentBonusSummary", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(model.WithdrawalSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SpentBonusSummary indicates an expected call of SpentBonusSummary.
+func (mr *MockStoreMockRecorder) SpentBonusSummary(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SpentBonusSummary", reflect.TypeOf((*MockStore)(nil).SpentBonusSummary), arg0, arg1, arg2, arg3)
+}
+
+// UserAccess mocks base method.
+func (m *MockStore) UserAccess(arg0 context.Context, arg1 int) (bool, model.Role, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserAccess", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(model.Role)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// UserAccess indicates an expected call of UserAccess.
+func (mr *MockStoreMockRecorder) UserAccess(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserAccess", reflect.TypeOf((*MockStore)(nil).UserAccess), arg0, arg1)
+}
@@ -2,6 +2,7 @@
 package model
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -15,21 +16,64 @@ var (
 	ErrOrderNotFound  = errors.New("order not found in accrual system")
 	ErrOrderInProcess = errors.New("order in process")
 	ErrNotEnough      = errors.New("not enough funds on balance")
+	ErrLoginThrottled = errors.New("too many failed login attempts")
+	ErrLoginTaken     = errors.New("login is already taken")
+	ErrUserBlocked    = errors.New("user is blocked")
+	ErrUserNotFound   = errors.New("user not found")
+	ErrNoOrder        = errors.New("order not found")
+	ErrOrderFinal     = errors.New("order is already in final status")
+	ErrBadAdjustment  = errors.New("invalid balance adjustment")
+	ErrNoMerchantKey  = errors.New("merchant key not found")
+	ErrNoWebhook      = errors.New("webhook not found")
+	ErrNoDelivery     = errors.New("webhook delivery not found")
+)
+
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
 )
 
 type User struct {
-	ID    int
-	Login string
-	Hash  []byte
+	ID      int
+	Login   string
+	Hash    []byte
+	Role    Role
+	Blocked bool
+}
+
+// UserInfo is a user as seen by administrators
+type UserInfo struct {
+	ID       int     `json:"id"`
+	Login    string  `json:"login"`
+	Role     Role    `json:"role"`
+	Blocked  bool    `json:"blocked"`
+	Sum      float64 `json:"current"`
+	WriteOff float64 `json:"withdrawn"`
 }
 
 type Order struct {
+	UserID     int         `json:"-"`
 	ID         int         `json:"number,string"`
 	Status     OrderStatus `json:"status"`
 	UploadedAt time.Time   `json:"uploaded_at"`
 	Accrual    *float64    `json:"accrual,omitempty"`
 }
 
+// OrderStatusEvent is a status of order seen in accrual system
+type OrderStatusEvent struct {
+	Status  OrderStatus `json:"status"`
+	Accrual *float64    `json:"accrual,omitempty"`
+	SeenAt  time.Time   `json:"seen_at"`
+}
+
+// OrderDetail is an order with its status timeline
+type OrderDetail struct {
+	Order
+	History []OrderStatusEvent `json:"history"`
+}
+
 type AccrualResp struct {
 	Order   int         `json:"order,string"`
 	Status  OrderStatus `json:"status"`
@@ -55,6 +99,9 @@ func (s OrderStatus) MarshalText() ([]byte, error) {
 // UnmarshalText implements the encoding.TextUnmarshaler interface.
 func (s *OrderStatus) UnmarshalText(b []byte) error {
 	switch string(b) {
+	case "NEW":
+		*s = OrderStatusNew
+		return nil
 	case "REGISTERED":
 		*s = OrderStatusRegistered
 		return nil
@@ -86,3 +133,270 @@ type PaymentFact struct {
 	Payment
 	ProcessedAt time.Time `json:"processed_at"`
 }
+
+// LoginAttempts is a counter of failed logins for one key (login or client IP)
+type LoginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+	InFlight    int // attempts reserved and not finished yet, including the own one
+}
+
+// AuditRecord describes a security relevant event
+type AuditRecord struct {
+	ActorID   int       `json:"actor_id,omitempty"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AdjustmentReason is a reason code of manual balance change
+type AdjustmentReason string
+
+const (
+	ReasonGoodwill     AdjustmentReason = "goodwill"
+	ReasonCorrection   AdjustmentReason = "correction"
+	ReasonCompensation AdjustmentReason = "compensation"
+	ReasonFraud        AdjustmentReason = "fraud"
+)
+
+func (r AdjustmentReason) Valid() bool {
+	switch r {
+	case ReasonGoodwill, ReasonCorrection, ReasonCompensation, ReasonFraud:
+		return true
+	}
+	return false
+}
+
+// Adjustment is a manual credit (positive amount) or debit (negative amount) made by support staff
+type Adjustment struct {
+	ID        int              `json:"id"`
+	Amount    float64          `json:"amount"`
+	Reason    AdjustmentReason `json:"reason"`
+	Comment   string           `json:"comment"`
+	AdminID   int              `json:"admin_id,omitempty"`
+	Force     bool             `json:"force,omitempty"` // allows balance to become negative
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// ScopeOrdersWrite allows merchant to attach orders to loyalty accounts
+const (
+	ScopeOrdersWrite = "orders:write"
+	ScopeWebhooks    = "webhooks:write"
+)
+
+// MerchantKey is an API key of a storefront backend. Only hash of the key is stored.
+type MerchantKey struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	CreatedBy int        `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	Key       string     `json:"key,omitempty"` // returned once on creation
+	Hash      []byte     `json:"-"`
+}
+
+func (k *MerchantKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Cursor is a position in a list sorted by time and id in descending order
+type Cursor struct {
+	At time.Time `json:"t"`
+	ID int       `json:"id"`
+}
+
+// OrderFilter selects a page of user orders. Zero values mean no restriction.
+type OrderFilter struct {
+	Limit    int
+	After    *Cursor
+	Statuses []OrderStatus
+	From     time.Time // inclusive
+	To       time.Time // exclusive
+}
+
+// PaymentFilter selects a page of user withdrawals. Zero values mean no restriction.
+type PaymentFilter struct {
+	Limit int
+	After *Cursor
+	From  time.Time // inclusive
+	To    time.Time // exclusive
+}
+
+type WithdrawalSummary struct {
+	Count int     `json:"count"`
+	Total float64 `json:"total"`
+}
+
+// OrderUploadResult is an outcome of one order in batch upload
+type OrderUploadResult string
+
+const (
+	UploadAccepted        OrderUploadResult = "accepted"
+	UploadAlreadyUploaded OrderUploadResult = "already_uploaded"
+	UploadOwnedByOther    OrderUploadResult = "owned_by_other_user"
+	UploadInvalidNumber   OrderUploadResult = "invalid_luhn"
+	UploadMalformed       OrderUploadResult = "malformed"
+)
+
+type OrderUpload struct {
+	Number string            `json:"number"`
+	Result OrderUploadResult `json:"result"`
+	ID     int               `json:"-"`
+	Status OrderStatus       `json:"-"` // status of already uploaded order
+}
+
+// Types of user events
+const (
+	EventOrderStatus    = "order_status"
+	EventOrderCredited  = "order_credited"
+	EventBalanceChanged = "balance_changed"
+	EventWithdrawal     = "withdrawal_confirmed"
+	// EventResync means missed events can't be replayed, client has to reload its data
+	EventResync = "resync"
+)
+
+// UserEvent is a change of user data delivered to clients in real time
+type UserEvent struct {
+	ID        int64           `json:"id"`
+	UserID    int             `json:"user_id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// OrderEventData is a payload of order_status and order_credited events
+type OrderEventData struct {
+	Number  int         `json:"number,string"`
+	Status  OrderStatus `json:"status"`
+	Accrual *float64    `json:"accrual,omitempty"`
+}
+
+// Webhook event types
+const (
+	WebhookOrderProcessed    = "order.processed"
+	WebhookOrderInvalid      = "order.invalid"
+	WebhookWithdrawalCreated = "withdrawal.created"
+)
+
+func ValidWebhookEvent(event string) bool {
+	switch event {
+	case WebhookOrderProcessed, WebhookOrderInvalid, WebhookWithdrawalCreated:
+		return true
+	}
+	return false
+}
+
+// WebhookOwner is a user or a merchant key, exactly one of ids is set
+type WebhookOwner struct {
+	UserID        int
+	MerchantKeyID int
+}
+
+// Webhook is a subscription of partner to events
+type Webhook struct {
+	ID        int          `json:"id"`
+	URL       string       `json:"url"`
+	Events    []string     `json:"events"`
+	Secret    string       `json:"secret,omitempty"` // returned once on creation
+	CreatedAt time.Time    `json:"created_at"`
+	Owner     WebhookOwner `json:"-"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed" // attempts are exhausted
+)
+
+// WebhookDelivery is an event queued for one webhook together with log of its delivery
+type WebhookDelivery struct {
+	ID            int64           `json:"id"`
+	WebhookID     int             `json:"webhook_id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        DeliveryStatus  `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastCode      int             `json:"last_response_code,omitempty"`
+	LastError     string          `json:"last_error,omitempty"`
+	NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	URL           string          `json:"-"`
+	Secret        string          `json:"-"`
+}
+
+// WebhookEvent is an outbox message queued for subscribed webhooks
+type WebhookEvent struct {
+	OutboxID  int64
+	UserID    int
+	OrderID   int // merchant which uploaded the order receives its events too
+	Event     string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// WebhookPayload is a body of webhook request
+type WebhookPayload struct {
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Types of outbox messages
+const (
+	OutboxOrderUploaded   = "order.uploaded"
+	OutboxOrderStatus     = "order.status_changed"
+	OutboxBalanceCredited = "balance.credited"
+	OutboxWithdrawal      = "withdrawal.created"
+	OutboxBalanceAdjusted = "balance.adjusted"
+)
+
+// OutboxMessage is a state change published to downstream consumers.
+// Delivery is at-least-once, consumers deduplicate by ID.
+type OutboxMessage struct {
+	ID        int64           `json:"id"`
+	UserID    int             `json:"user_id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// OrderUploadedData is a payload of order.uploaded message
+type OrderUploadedData struct {
+	Number     int         `json:"number,string"`
+	Status     OrderStatus `json:"status"`
+	UploadedAt time.Time   `json:"uploaded_at"`
+}
+
+// CreditData is a payload of balance.credited message
+type CreditData struct {
+	Number  int     `json:"number,string"`
+	Sum     float64 `json:"sum"`
+	Balance Balance `json:"balance"`
+}
+
+// AdjustmentData is a payload of balance.adjusted message, comment of admin isn't published
+type AdjustmentData struct {
+	ID      int              `json:"id"`
+	Amount  float64          `json:"amount"`
+	Reason  AdjustmentReason `json:"reason"`
+	Force   bool             `json:"force,omitempty"`
+	Balance Balance          `json:"balance"`
+}
+
+// QueuedOrder is an order waiting in polling queue
+type QueuedOrder struct {
+	OrderID   int
+	RequestID string // запрос, загрузивший заказ, для логов опроса; после перезапуска неизвестен
+	UserID    int
+}
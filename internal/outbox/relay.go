@@ -0,0 +1,117 @@
+// Package outbox publishes state changes saved to outbox table to downstream consumers
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gophermart/internal/model"
+)
+
+type Message = model.OutboxMessage
+
+// Store is an outbox table shared by all instances
+type Store interface {
+	TryLockOutbox(ctx context.Context) (unlock func(), ok bool, err error)
+	// ListOutbox returns unpublished messages from oldest, skipping messages of skipUsers
+	ListOutbox(ctx context.Context, limit int, skipUsers []int) ([]Message, error)
+	MarkOutboxPublished(ctx context.Context, ids []int64, at time.Time) error
+}
+
+// Publisher sends message to consumers. Message is retried until Publish returns nil.
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// Relay publishes outbox messages at least once. Messages of one user are published in order of ids,
+// so after a failure the rest of user messages wait for the next pass, messages of other users don't.
+type Relay struct {
+	store     Store
+	publisher Publisher
+	batchSize int
+	now       func() time.Time
+}
+
+func NewRelay(store Store, publisher Publisher, batchSize int) *Relay {
+	return &Relay{
+		store:     store,
+		publisher: publisher,
+		batchSize: batchSize,
+		now:       time.Now,
+	}
+}
+
+// Run publishes messages every interval until ctx is done
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.relay(ctx)
+		}
+	}
+}
+
+func (r *Relay) relay(ctx context.Context) {
+	// только один экземпляр публикует, иначе порядок сообщений пользователя не гарантирован
+	unlock, ok, err := r.store.TryLockOutbox(ctx)
+	if err != nil {
+		slog.Error(fmt.Sprintf("lock outbox: %s", err))
+		return
+	}
+	if !ok {
+		return
+	}
+	defer unlock()
+	// пользователи, сообщение которых не опубликовано; их остальные сообщения ждут следующего тика,
+	// а следующие пачки выбираются без них, чтобы не перечитывать ту же пачку
+	blocked := make(map[int]bool)
+	for ctx.Err() == nil {
+		// неполная пачка - сообщений больше нет
+		if r.publishBatch(ctx, blocked) < r.batchSize {
+			return
+		}
+	}
+}
+
+// publishBatch returns number of messages read from outbox, users with failed message are added to blocked
+func (r *Relay) publishBatch(ctx context.Context, blocked map[int]bool) int {
+	skip := make([]int, 0, len(blocked))
+	for userID := range blocked {
+		skip = append(skip, userID)
+	}
+	msgs, err := r.store.ListOutbox(ctx, r.batchSize, skip)
+	if err != nil {
+		slog.Error(fmt.Sprintf("list outbox: %s", err))
+		return 0
+	}
+	published := make([]int64, 0, len(msgs))
+	for _, msg := range msgs {
+		if blocked[msg.UserID] {
+			continue
+		}
+		if err := r.publisher.Publish(ctx, msg); err != nil {
+			slog.Warn("outbox publish failed",
+				slog.Int64("message_id", msg.ID),
+				slog.Int("user_id", msg.UserID),
+				slog.String("error", err.Error()),
+			)
+			blocked[msg.UserID] = true
+			continue
+		}
+		published = append(published, msg.ID)
+	}
+	if len(published) > 0 {
+		// если отметка не сохранится, сообщения будут опубликованы повторно
+		if err := r.store.MarkOutboxPublished(ctx, published, r.now()); err != nil {
+			slog.Error(fmt.Sprintf("mark outbox published: %s", err))
+			return 0
+		}
+	}
+	return len(msgs)
+}
@@ -0,0 +1,156 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+)
+
+type publisherFunc func(ctx context.Context, msg Message) error
+
+func (f publisherFunc) Publish(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+func TestRelay_relay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	m := NewMockStore(ctrl)
+	msgs := []Message{
+		{ID: 1, UserID: 7, Type: "order.uploaded"},
+		{ID: 2, UserID: 8, Type: "order.uploaded"},
+		{ID: 3, UserID: 7, Type: "order.status_changed"},
+		{ID: 4, UserID: 8, Type: "order.status_changed"},
+		{ID: 5, UserID: 9, Type: "withdrawal.created"},
+	}
+	var sent []int64
+	pub := publisherFunc(func(_ context.Context, msg Message) error {
+		if msg.ID == 2 {
+			return errors.New("consumer unavailable")
+		}
+		sent = append(sent, msg.ID)
+		return nil
+	})
+	unlocked := false
+	m.EXPECT().TryLockOutbox(gomock.Any()).Return(func() { unlocked = true }, true, nil)
+	m.EXPECT().ListOutbox(gomock.Any(), 5, []int{}).Return(msgs, nil)
+	// сообщение 4 ждёт, пока не будет опубликовано 2 того же пользователя
+	m.EXPECT().MarkOutboxPublished(gomock.Any(), []int64{1, 3, 5}, gomock.Any()).Return(nil)
+	m.EXPECT().ListOutbox(gomock.Any(), 5, []int{8}).Return(nil, nil)
+
+	NewRelay(m, pub, 5).relay(context.Background())
+
+	if diff := cmp.Diff([]int64{1, 3, 5}, sent); diff != "" {
+		t.Errorf("published messages mismatch (-want +got):\n%s", diff)
+	}
+	if !unlocked {
+		t.Error("outbox lock is not released")
+	}
+}
+
+func TestRelay_relayFailingUserDoesNotStallOthers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	m := NewMockStore(ctrl)
+	// у пользователя 7 накопилась целая пачка неопубликованных сообщений
+	stuck := []Message{{ID: 1, UserID: 7}, {ID: 2, UserID: 7}}
+	next := []Message{{ID: 3, UserID: 8}}
+	pub := publisherFunc(func(_ context.Context, msg Message) error {
+		if msg.UserID == 7 {
+			return errors.New("rejected by consumer")
+		}
+		return nil
+	})
+	m.EXPECT().TryLockOutbox(gomock.Any()).Return(func() {}, true, nil)
+	gomock.InOrder(
+		m.EXPECT().ListOutbox(gomock.Any(), 2, []int{}).Return(stuck, nil),
+		m.EXPECT().ListOutbox(gomock.Any(), 2, []int{7}).Return(next, nil),
+	)
+	m.EXPECT().MarkOutboxPublished(gomock.Any(), []int64{3}, gomock.Any()).Return(nil)
+
+	NewRelay(m, pub, 2).relay(context.Background())
+}
+
+func TestRelay_relayLockedByOtherInstance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	m := NewMockStore(ctrl)
+	m.EXPECT().TryLockOutbox(gomock.Any()).Return(nil, false, nil)
+
+	pub := publisherFunc(func(context.Context, Message) error {
+		t.Error("message published without lock")
+		return nil
+	})
+	NewRelay(m, pub, 5).relay(context.Background())
+}
+
+func TestWriterPublisher(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewWriterPublisher(&buf)
+	msg := Message{ID: 1, UserID: 7, Type: "order.uploaded", Data: []byte(`{"number":"7992723465"}`), CreatedAt: time.Unix(0, 0).UTC()}
+	if err := p.Publish(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":1,"user_id":7,"type":"order.uploaded","data":{"number":"7992723465"},"created_at":"1970-01-01T00:00:00Z"}` + "\n"
+	if buf.String() != want {
+		t.Errorf("got %s, want %s", buf.String(), want)
+	}
+}
+
+func TestHTTPPublisher(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int
+		wantErr bool
+	}{
+		{name: "accepted", code: http.StatusAccepted},
+		{name: "server_error", code: http.StatusServiceUnavailable, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Idempotency-Key") != "42" {
+					t.Errorf("got Idempotency-Key %q", r.Header.Get("Idempotency-Key"))
+				}
+				var msg Message
+				if err := json.NewDecoder(r.Body).Decode(&msg); err != nil || msg.ID != 42 {
+					t.Errorf("unexpected body %+v, %v", msg, err)
+				}
+				w.WriteHeader(tt.code)
+			}))
+			defer server.Close()
+
+			err := NewHTTPPublisher(server.URL, time.Second).Publish(context.Background(), Message{ID: 42, Data: []byte(`{}`)})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Publish() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMultiPublisher(t *testing.T) {
+	var calls []string
+	ok := publisherFunc(func(context.Context, Message) error {
+		calls = append(calls, "webhooks")
+		return nil
+	})
+	failing := publisherFunc(func(context.Context, Message) error {
+		calls = append(calls, "broker")
+		return errors.New("broker unavailable")
+	})
+	skipped := publisherFunc(func(context.Context, Message) error {
+		calls = append(calls, "file")
+		return nil
+	})
+	if err := (MultiPublisher{ok, failing, skipped}).Publish(context.Background(), Message{ID: 1}); err == nil {
+		t.Error("failure of publisher is lost")
+	}
+	if diff := cmp.Diff([]string{"webhooks", "broker"}, calls); diff != "" {
+		t.Errorf("publishers mismatch (-want +got):\n%s", diff)
+	}
+}
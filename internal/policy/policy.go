@@ -0,0 +1,137 @@
+// Package policy checks logins and passwords of new users
+package policy
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// bcrypt ignores everything after 72 bytes of password
+const bcryptMaxLen = 72
+
+const (
+	RuleLoginLength       = "login_length"
+	RuleLoginCharset      = "login_charset"
+	RuleLoginTaken        = "login_taken"
+	RulePasswordMinLength = "password_min_length"
+	RulePasswordMaxLength = "password_max_length"
+	RulePasswordCommon    = "password_common"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsList string
+
+var commonPasswords = func() map[string]struct{} {
+	m := make(map[string]struct{})
+	sc := bufio.NewScanner(strings.NewReader(commonPasswordsList))
+	for sc.Scan() {
+		if pwd := strings.TrimSpace(sc.Text()); pwd != "" {
+			m[strings.ToLower(pwd)] = struct{}{}
+		}
+	}
+	return m
+}()
+
+// Violation describes which rule was broken
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+type Policy struct {
+	LoginMinLen    int
+	LoginMaxLen    int
+	LoginCharset   *regexp.Regexp
+	PasswordMinLen int
+	PasswordMaxLen int // in bytes, no more than 72
+	RejectCommon   bool
+}
+
+// New creates policy, charset is a regular expression of one allowed login character
+func New(loginMinLen, loginMaxLen int, charset string, pwdMinLen, pwdMaxLen int, rejectCommon bool) (*Policy, error) {
+	if pwdMaxLen <= 0 || pwdMaxLen > bcryptMaxLen {
+		return nil, fmt.Errorf("password max length must be in range 1..%d, got %d", bcryptMaxLen, pwdMaxLen)
+	}
+	if pwdMinLen > pwdMaxLen {
+		return nil, fmt.Errorf("password min length %d is greater than max length %d", pwdMinLen, pwdMaxLen)
+	}
+	if loginMaxLen > 0 && loginMinLen > loginMaxLen {
+		return nil, fmt.Errorf("login min length %d is greater than max length %d", loginMinLen, loginMaxLen)
+	}
+	p := &Policy{
+		LoginMinLen:    loginMinLen,
+		LoginMaxLen:    loginMaxLen,
+		PasswordMinLen: pwdMinLen,
+		PasswordMaxLen: pwdMaxLen,
+		RejectCommon:   rejectCommon,
+	}
+	if charset != "" {
+		re, err := regexp.Compile("^(?:" + charset + ")+$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid login charset: %w", err)
+		}
+		p.LoginCharset = re
+	}
+	return p, nil
+}
+
+// Check returns *Violation if login or password breaks the policy
+func (p *Policy) Check(login, password string) error {
+	n := utf8.RuneCountInString(login)
+	if n < p.LoginMinLen || (p.LoginMaxLen > 0 && n > p.LoginMaxLen) {
+		return &Violation{
+			Field:   "login",
+			Rule:    RuleLoginLength,
+			Message: fmt.Sprintf("login length must be from %d to %d characters", p.LoginMinLen, p.LoginMaxLen),
+		}
+	}
+	if p.LoginCharset != nil && !p.LoginCharset.MatchString(login) {
+		return &Violation{
+			Field:   "login",
+			Rule:    RuleLoginCharset,
+			Message: "login contains forbidden characters",
+		}
+	}
+	if utf8.RuneCountInString(password) < p.PasswordMinLen {
+		return &Violation{
+			Field:   "password",
+			Rule:    RulePasswordMinLength,
+			Message: fmt.Sprintf("password must be at least %d characters long", p.PasswordMinLen),
+		}
+	}
+	if len(password) > p.PasswordMaxLen {
+		return &Violation{
+			Field:   "password",
+			Rule:    RulePasswordMaxLength,
+			Message: fmt.Sprintf("password must be no longer than %d bytes", p.PasswordMaxLen),
+		}
+	}
+	if p.RejectCommon {
+		if _, ok := commonPasswords[strings.ToLower(password)]; ok {
+			return &Violation{
+				Field:   "password",
+				Rule:    RulePasswordCommon,
+				Message: "password is too common",
+			}
+		}
+	}
+	return nil
+}
+
+// LoginTaken is returned when login is already used, ignoring case
+func LoginTaken() *Violation {
+	return &Violation{
+		Field:   "login",
+		Rule:    RuleLoginTaken,
+		Message: "login is already taken",
+	}
+}
@@ -0,0 +1,55 @@
+package policy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	p, err := New(3, 16, "[A-Za-z0-9._-]", 8, 72, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		wantRule string
+	}{
+		{name: "valid", login: "john.doe", password: "correct horse battery"},
+		{name: "short_login", login: "jd", password: "correct horse battery", wantRule: RuleLoginLength},
+		{name: "long_login", login: strings.Repeat("j", 17), password: "correct horse battery", wantRule: RuleLoginLength},
+		{name: "login_charset", login: "john doe", password: "correct horse battery", wantRule: RuleLoginCharset},
+		{name: "short_password", login: "john", password: "k7#pQ", wantRule: RulePasswordMinLength},
+		{name: "long_password", login: "john", password: strings.Repeat("я", 37), wantRule: RulePasswordMaxLength},
+		{name: "common_password", login: "john", password: "Password123", wantRule: RulePasswordCommon},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Check(tt.login, tt.password)
+			if tt.wantRule == "" {
+				if err != nil {
+					t.Errorf("Check() unexpected error %v", err)
+				}
+				return
+			}
+			var v *Violation
+			if !errors.As(err, &v) {
+				t.Fatalf("Check() error = %v, want violation", err)
+			}
+			if v.Rule != tt.wantRule {
+				t.Errorf("Check() rule = %s, want %s", v.Rule, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestNew_InvalidSettings(t *testing.T) {
+	if _, err := New(3, 16, "", 8, 100, true); err == nil {
+		t.Error("password max length over bcrypt limit should be rejected")
+	}
+	if _, err := New(3, 16, "[", 8, 72, true); err == nil {
+		t.Error("invalid charset should be rejected")
+	}
+}
@@ -10,9 +10,23 @@ import (
 	"strconv"
 	"time"
 
+	"gophermart/internal/metrics"
 	"gophermart/internal/model"
+	"gophermart/internal/tracing"
 
 	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	accrualResponses = metrics.NewCounterVec("gophermart_accrual_responses_total",
+		"Responses of accrual system by status code, code is error when request failed.", "code")
+	accrualThrottled = metrics.NewCounterVec("gophermart_accrual_throttled_total",
+		"Times accrual system answered 429 Too Many Requests.")
 )
 
 type errorManyRequests struct {
@@ -37,12 +51,9 @@ func polling(ctx context.Context, store Store, accrualAddr string, orderID int)
 
 	client := resty.New()
 
-	slog.Debug("Polling", slog.String("url", url))
+	slog.DebugContext(ctx, "Polling", slog.String("url", url))
 
-	resp, err := client.R().
-		SetContext(ctx).
-		SetHeader("Accept", "application/json").
-		Get(url)
+	resp, err := getAccrual(ctx, client, url, orderID)
 	if err != nil {
 		return err
 	}
@@ -86,3 +97,33 @@ func polling(ctx context.Context, store Store, accrualAddr string, orderID int)
 	}
 	return nil
 }
+
+// getAccrual requests order from accrual system in client span, trace context is passed in traceparent header
+func getAccrual(ctx context.Context, client *resty.Client, url string, orderID int) (*resty.Response, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "GET /api/orders/{number}",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			tracing.AttrOrderID.Int(orderID),
+			attribute.String("http.request.method", http.MethodGet),
+			attribute.String("url.full", url),
+		))
+	defer span.End()
+
+	req := client.R().
+		SetContext(ctx).
+		SetHeader("Accept", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := req.Get(url)
+	if err != nil {
+		accrualResponses.Inc("error")
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	accrualResponses.Inc(strconv.Itoa(resp.StatusCode()))
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode()))
+	if resp.StatusCode() >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, resp.Status())
+	}
+	return resp, nil
+}
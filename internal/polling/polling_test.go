@@ -1,17 +1,28 @@
 package polling
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"gophermart/internal/logging"
 	"gophermart/internal/model"
 
 	"github.com/golang/mock/gomock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type accrualResp = model.AccrualResp
@@ -140,3 +151,231 @@ func TestPolling(t *testing.T) {
 		})
 	}
 }
+
+func TestPollster_CheckAccrual(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("No more than 100 requests per minute allowed"))
+	}))
+	defer server.Close()
+
+	p := NewPollster(server.URL, setupMock(t))
+	if err := p.CheckRunning(context.Background()); err == nil {
+		t.Error("pollster is not started, check must fail")
+	}
+	if err := p.CheckAccrual(context.Background()); err != nil {
+		t.Errorf("accrual is not polled yet, got %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	p.poll(context.Background(), task{orderID: 7992723465}, &wg)
+	if err := p.CheckAccrual(context.Background()); err == nil {
+		t.Error("accrual throttles requests, check must fail")
+	}
+}
+
+func TestPolling_Traceparent(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	err := polling(context.Background(), setupMock(t), server.URL, 7992723465)
+	if !errors.Is(err, model.ErrOrderNotFound) {
+		t.Fatalf("got error %v, want %v", err, model.ErrOrderNotFound)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	want := "00-" + spans[0].SpanContext().TraceID().String() + "-" + spans[0].SpanContext().SpanID().String() + "-01"
+	if traceparent != want {
+		t.Errorf("got traceparent %q, want %q", traceparent, want)
+	}
+}
+
+func TestPollster_LogsRequestFields(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(logging.NewHandler(slog.NewTextHandler(&logs, nil))))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	p := NewPollster(server.URL, setupMock(t))
+	origin := logging.Fields{RequestID: "req-1", UserID: 42}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	p.poll(context.Background(), task{orderID: 7992723465, origin: origin}, &wg)
+
+	if !strings.Contains(logs.String(), "request_id=req-1 user_id=42") {
+		t.Errorf("polling error is not linked to request:\n%s", logs.String())
+	}
+}
+
+func TestPollster_Concurrency(t *testing.T) {
+	var mu sync.Mutex
+	var current, peak, total int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		current++
+		total++
+		peak = max(peak, current)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		current--
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	p := NewPollster(server.URL, setupMock(t), WithConcurrency(2))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx, 5*time.Millisecond)
+	p.PushBatch(ctx, []int{1, 2, 3, 4, 5, 6, 7, 8})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		done := total >= 8
+		mu.Unlock()
+		if done || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if total < 8 {
+		t.Fatalf("got %d requests to accrual, want 8", total)
+	}
+	if peak > 2 {
+		t.Errorf("got %d concurrent requests, want at most 2", peak)
+	}
+}
+
+func TestPollster_SetInterval(t *testing.T) {
+	polled := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case polled <- struct{}{}:
+		default:
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	p := NewPollster(server.URL, setupMock(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx, time.Hour)
+	p.Push(ctx, 7992723465)
+	p.SetInterval(5 * time.Millisecond)
+
+	select {
+	case <-polled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("new interval is not applied, order is not polled")
+	}
+}
+
+func TestPollster_Shutdown(t *testing.T) {
+	accrual := 100.0
+	t.Run("in_flight_poll_is_finished", func(t *testing.T) {
+		m := setupMock(t)
+		polled := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			close(polled)
+			time.Sleep(20 * time.Millisecond)
+			json.NewEncoder(w).Encode(accrualResp{Order: 1, Status: model.OrderStatusProcessed, Accrual: &accrual})
+		}))
+		defer server.Close()
+		m.EXPECT().UpdateOrderInfo(gomock.Any(), gomock.Any()).Return(nil)
+
+		p := NewPollster(server.URL, m)
+		go p.Run(context.Background(), 5*time.Millisecond)
+		p.Push(context.Background(), 1)
+		<-polled
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if left := p.Shutdown(ctx); left != 0 {
+			t.Errorf("got %d left in queue, want poll to finish", left)
+		}
+	})
+
+	t.Run("queue_is_left_on_deadline", func(t *testing.T) {
+		polled := make(chan struct{}, 3)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			polled <- struct{}{}
+			// accrual завис, опрос прерывается только по сроку остановки
+			<-req.Context().Done()
+		}))
+		defer server.Close()
+
+		p := NewPollster(server.URL, setupMock(t), WithConcurrency(1))
+		go p.Run(context.Background(), 5*time.Millisecond)
+		ctx := logging.WithFields(context.Background(), logging.Fields{RequestID: "req-1", UserID: 42})
+		p.PushBatch(ctx, []int{1, 2, 3})
+		<-polled
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if left := p.Shutdown(shutdownCtx); left != 3 {
+			t.Errorf("got %d left in queue, want 3", left)
+		}
+		if err := p.CheckRunning(context.Background()); err == nil {
+			t.Error("pollster is still running after shutdown")
+		}
+	})
+}
+
+func TestPollster_Claim(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	claimer := NewMockClaimer(ctrl)
+	p := NewPollster("", setupMock(t), WithClaimer(claimer))
+	origin := logging.Fields{RequestID: "req-1", UserID: 42}
+	tasks := []task{{orderID: 1, origin: origin}, {orderID: 2, origin: origin}, {orderID: 3, origin: origin}}
+
+	t.Run("orders_of_other_replicas_wait_in_queue", func(t *testing.T) {
+		// 1 - арендован этой репликой, 2 - другой, у 3 уже окончательный статус
+		claimer.EXPECT().ClaimOrderPolls(gomock.Any(), []int{1, 2, 3}, p.owner, pollLease).Return([]int{1}, []int{2}, nil)
+
+		mine := p.claim(context.Background(), tasks)
+		if len(mine) != 1 || mine[0].orderID != 1 {
+			t.Errorf("got %v to poll, want order 1", mine)
+		}
+		if retries := p.takeRetries(); len(retries) != 1 || retries[0] != tasks[1] {
+			t.Errorf("got %v requeued, want order 2", retries)
+		}
+	})
+
+	t.Run("queue_is_kept_on_error", func(t *testing.T) {
+		claimer.EXPECT().ClaimOrderPolls(gomock.Any(), []int{1, 2, 3}, p.owner, pollLease).Return(nil, nil, errors.New("connection reset"))
+
+		if mine := p.claim(context.Background(), tasks); len(mine) != 0 {
+			t.Errorf("got %v to poll, want none", mine)
+		}
+		if retries := p.takeRetries(); !slices.Equal(retries, tasks) {
+			t.Errorf("got %v requeued, want all tasks", retries)
+		}
+	})
+}
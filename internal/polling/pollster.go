@@ -4,107 +4,406 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"gophermart/internal/logging"
 	"gophermart/internal/model"
+	"gophermart/internal/tracing"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
 )
 
 // Нужно опрашивать внешний сервис Acrual с каким-то интервалом до тех пор, пока он не вернет нужный статус по заказу PROCESSED или INVALID
 
+// tickerLog keeps the line of every tick, but not more than once a minute
+var tickerLog = logging.NewSampler(1, time.Minute)
+
+// pollLease is how long order stays with replica which claimed it, the owner extends it on every tick.
+// Orders of a stopped replica are taken by others after the lease expires.
+const pollLease = time.Minute
+
+// Claimer leases orders to replicas, so every order is polled by one of them at a time
+type Claimer interface {
+	ClaimOrderPolls(ctx context.Context, orderIDs []int, owner string, lease time.Duration) (claimed, leased []int, err error)
+}
+
+// task is an order to poll together with log fields of request that uploaded it
+type task struct {
+	orderID int
+	origin  logging.Fields
+}
+
 type Pollster struct {
-	incoming    chan int
-	orders      []int
+	incoming    chan []task
+	orders      []task
 	stopCh      chan struct{}
 	accrualAddr string
 	store       Store
+	claimer     Claimer
+	owner       string // идентификатор экземпляра в аренде заказов
 	limiter     *rate.Limiter
+	slots       *slots
+	intervalCh  chan time.Duration
+	stopOnce    sync.Once
+	done        chan struct{} // закрывается при выходе из Run
+	abortCh     chan struct{} // закрывается, если опросы не завершились к сроку Shutdown
+	// заказы, возвращённые в очередь опросами или после остановки
+	mu      sync.Mutex
+	retries []task
+	// читаются метриками из других горутин
+	queued   atomic.Int64
+	inFlight atomic.Int64
+	running  atomic.Bool
+	started  atomic.Bool
+	// состояние accrual для проверки готовности
+	throttledUntil atomic.Int64 // unix nano
+	unreachable    atomic.Bool
 }
 
-func NewPollster(accrualAddr string, store Store) *Pollster {
-	incoming := make(chan int)
-	orders := make([]int, 0)
+// Option configures Pollster
+type Option func(p *Pollster)
+
+// WithConcurrency limits number of orders polled at once, zero means no limit
+func WithConcurrency(n int) Option {
+	return func(p *Pollster) {
+		p.SetConcurrency(n)
+	}
+}
+
+// WithClaimer makes replica poll only orders leased to it, without it every queued order is polled
+func WithClaimer(c Claimer) Option {
+	return func(p *Pollster) {
+		p.claimer = c
+	}
+}
+
+// WithRateLimit limits requests per second to accrual system, zero means no limit
+func WithRateLimit(rps float64) Option {
+	return func(p *Pollster) {
+		p.SetRateLimit(rps)
+	}
+}
+
+func NewPollster(accrualAddr string, store Store, opts ...Option) *Pollster {
+	incoming := make(chan []task)
+	orders := make([]task, 0)
 	stopCh := make(chan struct{})
 	limiter := rate.NewLimiter(rate.Inf, 1_000_000)
-	return &Pollster{
-		incoming,
-		orders,
-		stopCh,
-		accrualAddr,
-		store,
-		limiter,
+	p := &Pollster{
+		incoming:    incoming,
+		orders:      orders,
+		stopCh:      stopCh,
+		accrualAddr: accrualAddr,
+		store:       store,
+		owner:       uuid.NewString(),
+		limiter:     limiter,
+		slots:       newSlots(0),
+		intervalCh:  make(chan time.Duration, 1),
+		done:        make(chan struct{}),
+		abortCh:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// SetConcurrency changes limit of WithConcurrency, polls in progress are not interrupted
+func (p *Pollster) SetConcurrency(n int) {
+	p.slots.setLimit(n)
+}
+
+// SetRateLimit changes limit of WithRateLimit, accrual system may lower it again with 429 response
+func (p *Pollster) SetRateLimit(rps float64) {
+	if rps <= 0 {
+		p.limiter.SetLimit(rate.Inf)
+		p.limiter.SetBurst(1_000_000)
+		return
+	}
+	p.limiter.SetLimit(rate.Limit(rps))
+	p.limiter.SetBurst(max(1, int(rps)))
+}
+
+// SetInterval changes interval given to Run, queue is kept
+func (p *Pollster) SetInterval(d time.Duration) {
+	for {
+		select {
+		case p.intervalCh <- d:
+			return
+		case <-p.intervalCh:
+			// предыдущее значение ещё не применено, заменяем его
+		}
+	}
+}
+
+// QueueDepth is number of orders waiting for the next tick
+func (p *Pollster) QueueDepth() int {
+	return int(p.queued.Load())
+}
+
+// InFlight is number of requests to accrual system in progress
+func (p *Pollster) InFlight() int {
+	return int(p.inFlight.Load())
+}
+
+// RateLimit is current limit of requests per second to accrual system, +Inf when unlimited
+func (p *Pollster) RateLimit() float64 {
+	return float64(p.limiter.Limit())
+}
+
+// Push adds order to polling queue, logs of polling get request_id and user_id of ctx
+func (p *Pollster) Push(ctx context.Context, orderID int) {
+	p.push(task{orderID: orderID, origin: logging.FromContext(ctx)})
+}
+
+// PushBatch adds several orders to polling queue at once
+func (p *Pollster) PushBatch(ctx context.Context, orderIDs []int) {
+	origin := logging.FromContext(ctx)
+	tasks := make([]task, 0, len(orderIDs))
+	for _, orderID := range orderIDs {
+		tasks = append(tasks, task{orderID: orderID, origin: origin})
+	}
+	p.push(tasks...)
+}
+
+// Resume pushes orders left unfinished by previous runs
+func (p *Pollster) Resume(orders []model.QueuedOrder) {
+	tasks := make([]task, 0, len(orders))
+	for _, o := range orders {
+		tasks = append(tasks, task{orderID: o.OrderID, origin: logging.Fields{RequestID: o.RequestID, UserID: o.UserID}})
+	}
+	p.push(tasks...)
+}
+
+// push blocks until Run takes tasks, after Stop they are kept for Shutdown
+func (p *Pollster) push(tasks ...task) {
+	select {
+	case p.incoming <- tasks:
+	case <-p.stopCh:
+		p.requeue(tasks...)
 	}
 }
 
-func (p *Pollster) Push(OrderID int) {
-	p.incoming <- OrderID
+// requeue returns tasks to the next tick, it doesn't block while Run waits for polls
+func (p *Pollster) requeue(tasks ...task) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.retries = append(p.retries, tasks...)
+}
+
+func (p *Pollster) takeRetries() []task {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	tasks := p.retries
+	p.retries = make([]task, 0)
+	return tasks
+}
+
+func (p *Pollster) stopped() bool {
+	select {
+	case <-p.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// CheckRunning fails when polling loop is not running
+func (p *Pollster) CheckRunning(context.Context) error {
+	if !p.running.Load() {
+		return errors.New("pollster is not running")
+	}
+	return nil
+}
+
+// CheckAccrual fails while accrual system throttles requests or refuses connections
+func (p *Pollster) CheckAccrual(context.Context) error {
+	if until := time.Unix(0, p.throttledUntil.Load()); time.Now().Before(until) {
+		return fmt.Errorf("accrual system throttles requests until %s", until.Format(time.RFC3339))
+	}
+	if p.unreachable.Load() {
+		return errors.New("accrual system refuses connections")
+	}
+	return nil
 }
 
 func (p *Pollster) Run(ctx context.Context, polInterval time.Duration) {
+	p.started.Store(true)
+	defer close(p.done)
+	if p.stopped() {
+		return
+	}
+	p.running.Store(true)
+	defer p.running.Store(false)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.abortCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 	ticker := time.NewTicker(polInterval)
 	for {
 		select {
+		case d := <-p.intervalCh:
+			ticker.Reset(d)
+			slog.InfoContext(ctx, "Pollster interval changed", slog.Duration("interval", d))
 		case <-ticker.C:
 			tasksCount := len(p.orders)
-			slog.Debug(fmt.Sprintf("Pollster ticker. Tasks in background: %d", tasksCount))
+			if ok, dropped := tickerLog.Sample(ctx, slog.LevelDebug); ok {
+				slog.DebugContext(ctx, fmt.Sprintf("Pollster ticker. Tasks in background: %d", tasksCount), slog.Int("sampled_out", dropped))
+			}
 			var wg sync.WaitGroup
-			wg.Add(tasksCount)
-			for _, orderID := range p.orders {
-				if err := p.limiter.Wait(ctx); err == nil {
-					go p.poll(ctx, orderID, &wg)
-				} else {
-					wg.Done()
-					go p.Push(orderID)
+			orders := p.claim(ctx, p.orders)
+			for i, t := range orders {
+				if p.stopped() {
+					// после остановки новые опросы не начинаются, остаток очереди возвращает Shutdown
+					p.requeue(orders[i:]...)
+					break
+				}
+				if err := p.limiter.Wait(ctx); err != nil {
+					p.requeue(t)
+					continue
 				}
+				p.slots.acquire()
+				wg.Add(1)
+				go func(t task) {
+					defer p.slots.release()
+					p.poll(ctx, t, &wg)
+				}(t)
 			}
 			wg.Wait()
-			p.orders = make([]int, 0)
+			p.orders = p.takeRetries()
+			p.queued.Store(int64(len(p.orders)))
 		case <-ctx.Done():
-			slog.Info(ctx.Err().Error())
+			slog.InfoContext(ctx, ctx.Err().Error())
 			return
 		case <-p.stopCh:
-			slog.Info("Pollster stopped")
+			slog.InfoContext(ctx, "Pollster stopped")
 			return
-		case orderID := <-p.incoming:
-			p.orders = append(p.orders, orderID)
+		case tasks := <-p.incoming:
+			p.orders = append(p.orders, tasks...)
+			p.queued.Store(int64(len(p.orders)))
 		default:
 			continue
 		}
 	}
 }
 
+// claim returns tasks leased to this replica. Tasks leased to others are requeued in case their owner stops,
+// tasks of orders with final status are dropped.
+func (p *Pollster) claim(ctx context.Context, tasks []task) []task {
+	if p.claimer == nil || len(tasks) == 0 {
+		return tasks
+	}
+	ids := make([]int, 0, len(tasks))
+	for _, t := range tasks {
+		ids = append(ids, t.orderID)
+	}
+	claimed, leased, err := p.claimer.ClaimOrderPolls(ctx, ids, p.owner, pollLease)
+	if err != nil {
+		slog.ErrorContext(ctx, fmt.Sprintf("claim orders for polling: %s", err))
+		p.requeue(tasks...)
+		return nil
+	}
+	own := make(map[int]bool, len(claimed))
+	for _, id := range claimed {
+		own[id] = true
+	}
+	others := make(map[int]bool, len(leased))
+	for _, id := range leased {
+		others[id] = true
+	}
+	mine := make([]task, 0, len(claimed))
+	for _, t := range tasks {
+		switch {
+		case own[t.orderID]:
+			mine = append(mine, t)
+		case others[t.orderID]:
+			p.requeue(t)
+		}
+	}
+	return mine
+}
+
+// Stop stops intake and polling loop without waiting, see Shutdown
 func (p *Pollster) Stop() {
-	close(p.stopCh)
+	p.stopOnce.Do(func() { close(p.stopCh) })
+}
+
+// Shutdown stops intake and waits for polls in progress until ctx is done, then cancels them.
+// Returns the number of orders left in queue, their status stays unfinished and they are polled
+// by other replicas or after restart.
+func (p *Pollster) Shutdown(ctx context.Context) int {
+	p.Stop()
+	if p.started.Load() {
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			slog.WarnContext(ctx, "Pollster shutdown deadline exceeded, polls in progress are cancelled",
+				slog.Int64("in_flight", p.inFlight.Load()))
+			close(p.abortCh)
+			<-p.done
+		}
+	}
+	left := len(p.orders) + len(p.takeRetries())
+	p.orders = make([]task, 0)
+	p.queued.Store(0)
+	return left
 }
 
-func (p *Pollster) poll(ctx context.Context, orderID int, wg *sync.WaitGroup) {
+func (p *Pollster) poll(ctx context.Context, t task, wg *sync.WaitGroup) {
 	defer wg.Done()
+	p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	ctx = logging.WithFields(ctx, t.origin)
+	orderID := t.orderID
+	// каждый опрос - отдельная трасса, с загрузкой заказа её связывает ссылка из store и атрибут с номером заказа
+	ctx, span := tracing.Tracer().Start(ctx, "pollster.poll",
+		trace.WithNewRoot(),
+		trace.WithAttributes(tracing.AttrOrderID.Int(orderID)))
+	defer span.End()
 	err := polling(ctx, p.store, p.accrualAddr, orderID)
+	if err != nil {
+		span.SetAttributes(attribute.String("gophermart.poll.result", err.Error()))
+	}
+	refused := errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.Errno(10061)) // golang.org/x/sys/windows WSAECONNREFUSED
+	p.unreachable.Store(refused)
 	var emr *errorManyRequests
 	if err != nil {
-		if errors.Is(err, model.ErrOrderNotFound) ||
+		if ctx.Err() != nil {
+			// опрос отменён при остановке, заказ останется в очереди
+			p.requeue(t)
+		} else if errors.Is(err, model.ErrOrderNotFound) ||
 			errors.Is(err, model.ErrOrderInProcess) ||
-			errors.Is(err, syscall.ECONNREFUSED) ||
-			errors.Is(err, syscall.Errno(10061)) { // golang.org/x/sys/windows WSAECONNREFUSED
-			go p.Push(orderID)
+			refused {
+			p.requeue(t)
 		} else if errors.As(err, &emr) {
-			slog.Debug(fmt.Sprintf("%s downtime=%v rps=%f", emr.Error(), emr.downtime, emr.rps))
+			accrualThrottled.Inc()
+			p.throttledUntil.Store(time.Now().Add(emr.downtime).UnixNano())
+			slog.DebugContext(ctx, fmt.Sprintf("%s downtime=%v rps=%f", emr.Error(), emr.downtime, emr.rps))
 
 			p.limiter.SetLimit(rate.Limit(emr.rps))
 			p.limiter.SetBurst(0)
-			slog.Debug(fmt.Sprintf("New limit: %f burst: %d", p.limiter.Limit(), p.limiter.Burst()))
+			slog.DebugContext(ctx, fmt.Sprintf("New limit: %f burst: %d", p.limiter.Limit(), p.limiter.Burst()))
 
 			time.AfterFunc(emr.downtime, func() {
 				p.limiter.SetBurst(int(emr.rps))
-				slog.Debug(fmt.Sprintf("New burst: %d", p.limiter.Burst()))
+				slog.DebugContext(ctx, fmt.Sprintf("New burst: %d", p.limiter.Burst()))
 			})
 
-			go p.Push(orderID)
+			p.requeue(t)
 		} else {
-			slog.Error(fmt.Errorf("polling error: %w", err).Error())
+			slog.ErrorContext(ctx, fmt.Errorf("polling error: %w", err).Error(), slog.Int("order_id", orderID))
 		}
 	}
 }
@@ -0,0 +1,40 @@
+package polling
+
+import "sync"
+
+// slots limits number of concurrent polls, limit can be changed while polls run
+type slots struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	used  int
+	limit int // 0 - без ограничения
+}
+
+func newSlots(limit int) *slots {
+	s := &slots{limit: limit}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *slots) acquire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.limit > 0 && s.used >= s.limit {
+		s.cond.Wait()
+	}
+	s.used++
+}
+
+func (s *slots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used--
+	s.cond.Signal()
+}
+
+func (s *slots) setLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+	s.cond.Broadcast()
+}
@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: gophermart/internal/polling (interfaces: Store)
+// Source: gophermart/internal/polling (interfaces: Store,Claimer)
 
 // Package polling is a generated GoMock package.
 package polling
@@ -8,6 +8,7 @@ import (
 	context "context"
 	model "gophermart/internal/model"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -48,3 +49,42 @@ func (mr *MockStoreMockRecorder) UpdateOrderInfo(arg0, arg1 interface{}) *gomock
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrderInfo", reflect.TypeOf((*MockStore)(nil).UpdateOrderInfo), arg0, arg1)
 }
+
+// MockClaimer is a mock of Claimer interface.
+type MockClaimer struct {
+	ctrl     *gomock.Controller
+	recorder *MockClaimerMockRecorder
+}
+
+// MockClaimerMockRecorder is the mock recorder for MockClaimer.
+type MockClaimerMockRecorder struct {
+	mock *MockClaimer
+}
+
+// NewMockClaimer creates a new mock instance.
+func NewMockClaimer(ctrl *gomock.Controller) *MockClaimer {
+	mock := &MockClaimer{ctrl: ctrl}
+	mock.recorder = &MockClaimerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockClaimer) EXPECT() *MockClaimerMockRecorder {
+	return m.recorder
+}
+
+// ClaimOrderPolls mocks base method.
+func (m *MockClaimer) ClaimOrderPolls(arg0 context.Context, arg1 []int, arg2 string, arg3 time.Duration) ([]int, []int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimOrderPolls", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]int)
+	ret1, _ := ret[1].([]int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ClaimOrderPolls indicates an expected call of ClaimOrderPolls.
+func (mr *MockClaimerMockRecorder) ClaimOrderPolls(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimOrderPolls", reflect.TypeOf((*MockClaimer)(nil).ClaimOrderPolls), arg0, arg1, arg2, arg3)
+}
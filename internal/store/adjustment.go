@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gophermart/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Adjustment = model.Adjustment
+
+func (db *Store) CreateAdjustmentsTable(ctx context.Context) error {
+	_, err := db.Exec(ctx,
+		`CREATE TABLE IF NOT EXISTS balance_adjustments (
+			id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			user_id bigint NOT NULL,
+			admin_id bigint NOT NULL,
+			amount double precision NOT NULL,
+			reason text NOT NULL,
+			comment text NOT NULL,
+			forced boolean NOT NULL,
+			created_at timestamp with time zone NOT NULL)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx,
+		`CREATE INDEX IF NOT EXISTS balance_adjustments_user_idx ON balance_adjustments (user_id, created_at)`)
+	return err
+}
+
+// AdjustBalance changes user balance and records the adjustment together with audit record in one transaction
+func (db *Store) AdjustBalance(ctx context.Context, userID int, adj Adjustment) (_ Adjustment, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return adj, err
+	}
+	var events []UserEvent
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+		if err = tx.Commit(ctx); err == nil {
+			db.publish(events)
+			countAdjustment(adj.Amount)
+		}
+	}()
+	if err = lockUserOutbox(ctx, tx, userID); err != nil {
+		return adj, err
+	}
+	row := tx.QueryRow(ctx, "SELECT sum FROM users WHERE id = @id FOR UPDATE", pgx.NamedArgs{"id": userID})
+	var sum float64
+	err = row.Scan(&sum)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = model.ErrUserNotFound
+		return adj, err
+	}
+	if err != nil {
+		return adj, err
+	}
+	if sum+adj.Amount < 0 && !adj.Force {
+		err = model.ErrNotEnough
+		return adj, err
+	}
+	adj.CreatedAt = time.Now()
+	row = tx.QueryRow(ctx,
+		`INSERT INTO balance_adjustments (user_id, admin_id, amount, reason, comment, forced, created_at)
+		VALUES (@user_id, @admin_id, @amount, @reason, @comment, @forced, @created_at) RETURNING id`,
+		pgx.NamedArgs{
+			"user_id":    userID,
+			"admin_id":   adj.AdminID,
+			"amount":     adj.Amount,
+			"reason":     adj.Reason,
+			"comment":    adj.Comment,
+			"forced":     adj.Force,
+			"created_at": adj.CreatedAt,
+		})
+	err = row.Scan(&adj.ID)
+	if err != nil {
+		return adj, err
+	}
+	_, err = tx.Exec(ctx, insertAudit, auditArgs(AuditRecord{
+		ActorID:   adj.AdminID,
+		Action:    "adjust_balance",
+		Target:    fmt.Sprintf("user:%d", userID),
+		Details:   fmt.Sprintf("adjustment:%d amount:%v reason:%s force:%t", adj.ID, adj.Amount, adj.Reason, adj.Force),
+		CreatedAt: adj.CreatedAt,
+	}))
+	if err != nil {
+		return adj, err
+	}
+	var balance Balance
+	row = tx.QueryRow(ctx, "UPDATE users SET sum = sum + @amount WHERE id = @id RETURNING sum, writeoff", pgx.NamedArgs{"amount": adj.Amount, "id": userID})
+	if err = row.Scan(&balance.Sum, &balance.WriteOff); err != nil {
+		return adj, err
+	}
+	ev, err := addUserEvent(ctx, tx, userID, model.EventBalanceChanged, balance)
+	if err != nil {
+		return adj, err
+	}
+	events = append(events, ev)
+	err = addOutbox(ctx, tx, userID, model.OutboxBalanceAdjusted, model.AdjustmentData{
+		ID:      adj.ID,
+		Amount:  adj.Amount,
+		Reason:  adj.Reason,
+		Force:   adj.Force,
+		Balance: balance,
+	})
+	return adj, err
+}
+
+func (db *Store) ListAdjustments(ctx context.Context, userID int) ([]Adjustment, error) {
+	adjustments := []Adjustment{}
+	rows, err := db.Query(ctx,
+		`SELECT id, admin_id, amount, reason, comment, forced, created_at
+		FROM balance_adjustments WHERE user_id = @user_id ORDER BY created_at DESC`,
+		pgx.NamedArgs{"user_id": userID})
+	if err != nil {
+		return adjustments, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		adj := Adjustment{}
+		err = rows.Scan(&adj.ID, &adj.AdminID, &adj.Amount, &adj.Reason, &adj.Comment, &adj.Force, &adj.CreatedAt)
+		if err != nil {
+			return adjustments, err
+		}
+		adjustments = append(adjustments, adj)
+	}
+	return adjustments, rows.Err()
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"gophermart/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type UserInfo = model.UserInfo
+type Role = model.Role
+
+// SearchUsers finds users which login contains query, ignoring case
+func (db *Store) SearchUsers(ctx context.Context, query string, limit int) ([]UserInfo, error) {
+	users := []UserInfo{}
+	rows, err := db.Query(ctx,
+		`SELECT id, login, role, blocked, sum, writeoff
+		FROM users
+		WHERE position(lower(@query) in lower(login)) > 0
+		ORDER BY id LIMIT @limit`,
+		pgx.NamedArgs{"query": query, "limit": limit})
+	if err != nil {
+		return users, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		u := UserInfo{}
+		err = rows.Scan(&u.ID, &u.Login, &u.Role, &u.Blocked, &u.Sum, &u.WriteOff)
+		if err != nil {
+			return users, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// SetBlocked blocks or unblocks user, audit record is written in the same transaction
+func (db *Store) SetBlocked(ctx context.Context, userID int, blocked bool, rec AuditRecord) error {
+	return db.audited(ctx, rec, func(tx pgx.Tx) error {
+		ct, err := tx.Exec(ctx, "UPDATE users SET blocked = @blocked WHERE id = @id", pgx.NamedArgs{"id": userID, "blocked": blocked})
+		if err != nil {
+			return err
+		}
+		if ct.RowsAffected() == 0 {
+			return model.ErrUserNotFound
+		}
+		return nil
+	})
+}
+
+// UserAccess returns whether user is blocked and the current role of user.
+// Deleted users are blocked too.
+func (db *Store) UserAccess(ctx context.Context, userID int) (blocked bool, role Role, err error) {
+	row := db.QueryRow(ctx, "SELECT blocked, role FROM users WHERE id = @id", pgx.NamedArgs{"id": userID})
+	err = row.Scan(&blocked, &role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return true, model.RoleUser, nil
+	}
+	return blocked, role, err
+}
+
+// SetRole grants role to user with the login
+func (db *Store) SetRole(ctx context.Context, login string, role Role) error {
+	ct, err := db.Exec(ctx, "UPDATE users SET role = @role WHERE login = @login", pgx.NamedArgs{"login": login, "role": role})
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return model.ErrUserNotFound
+	}
+	return nil
+}
+
+// RevokeAdmins demotes admins which logins are not listed, it returns number of demoted users
+func (db *Store) RevokeAdmins(ctx context.Context, keep []string) (int64, error) {
+	if keep == nil {
+		keep = []string{}
+	}
+	ct, err := db.Exec(ctx,
+		"UPDATE users SET role = @user WHERE role = @admin AND login <> ALL(@keep)",
+		pgx.NamedArgs{"user": model.RoleUser, "admin": model.RoleAdmin, "keep": keep})
+	if err != nil {
+		return 0, err
+	}
+	return ct.RowsAffected(), nil
+}
+
+func (db *Store) GetOrder(ctx context.Context, orderID int) (*Order, error) {
+	order := &Order{ID: orderID}
+	row := db.QueryRow(ctx, "SELECT user_id, status, uploaded_at, accrual FROM orders WHERE id = @id", pgx.NamedArgs{"id": orderID})
+	err := row.Scan(&order.UserID, &order.Status, &order.UploadedAt, &order.Accrual)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return order, model.ErrNoOrder
+	}
+	return order, err
+}
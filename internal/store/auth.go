@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gophermart/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type LoginAttempts = model.LoginAttempts
+type AuditRecord = model.AuditRecord
+
+func (db *Store) CreateLoginAttemptsTable(ctx context.Context) error {
+	_, err := db.Exec(ctx,
+		`CREATE TABLE IF NOT EXISTS login_attempts (
+			key text NOT NULL PRIMARY KEY,
+			failures integer NOT NULL,
+			last_failure timestamp with time zone NOT NULL,
+			locked_until timestamp with time zone)`) // key - "login:<login>" или "ip:<address>"
+	if err != nil {
+		return err
+	}
+	// in_flight - попытки, пароль которых проверяется прямо сейчас
+	_, err = db.Exec(ctx,
+		`ALTER TABLE login_attempts
+			ADD COLUMN IF NOT EXISTS in_flight integer NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS reserved_at timestamp with time zone`)
+	return err
+}
+
+func (db *Store) CreateAuditTable(ctx context.Context) error {
+	_, err := db.Exec(ctx,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			actor_id bigint,
+			action text NOT NULL,
+			target text NOT NULL,
+			details text,
+			created_at timestamp with time zone NOT NULL)`)
+	return err
+}
+
+// ReserveLogin registers attempt in flight and returns counters including it. Reservations made
+// before stale are considered abandoned by died replica and dropped.
+func (db *Store) ReserveLogin(ctx context.Context, key string, at, stale time.Time) (LoginAttempts, error) {
+	a := LoginAttempts{}
+	var lockedUntil *time.Time
+	// строка блокируется на время upsert, параллельные попытки видят резервы друг друга
+	row := db.QueryRow(ctx,
+		`INSERT INTO login_attempts (key, failures, last_failure, in_flight, reserved_at) VALUES (@key, 0, @at, 1, @at)
+		ON CONFLICT (key) DO UPDATE SET
+			in_flight = CASE WHEN login_attempts.reserved_at IS NULL OR login_attempts.reserved_at < @stale
+				THEN 1 ELSE login_attempts.in_flight + 1 END,
+			reserved_at = @at
+		RETURNING failures, last_failure, locked_until, in_flight`,
+		pgx.NamedArgs{"key": key, "at": at, "stale": stale})
+	err := row.Scan(&a.Failures, &a.LastFailure, &lockedUntil, &a.InFlight)
+	if lockedUntil != nil {
+		a.LockedUntil = *lockedUntil
+	}
+	return a, err
+}
+
+// ReleaseLogin finishes reserved attempt without verdict
+func (db *Store) ReleaseLogin(ctx context.Context, key string) error {
+	_, err := db.Exec(ctx, "UPDATE login_attempts SET in_flight = GREATEST(in_flight - 1, 0) WHERE key = @key",
+		pgx.NamedArgs{"key": key})
+	return err
+}
+
+// LoginFailure increments failed attempts counter and releases reserved attempt. Failures before since are forgotten.
+func (db *Store) LoginFailure(ctx context.Context, key string, at, since time.Time) (LoginAttempts, error) {
+	a := LoginAttempts{}
+	var lockedUntil *time.Time
+	row := db.QueryRow(ctx,
+		`INSERT INTO login_attempts (key, failures, last_failure) VALUES (@key, 1, @at)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure < @since THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure = @at,
+			in_flight = GREATEST(login_attempts.in_flight - 1, 0)
+		RETURNING failures, last_failure, locked_until`,
+		pgx.NamedArgs{"key": key, "at": at, "since": since})
+	err := row.Scan(&a.Failures, &a.LastFailure, &lockedUntil)
+	if lockedUntil != nil {
+		a.LockedUntil = *lockedUntil
+	}
+	return a, err
+}
+
+func (db *Store) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := db.Exec(ctx, "UPDATE login_attempts SET locked_until = @until WHERE key = @key", pgx.NamedArgs{"key": key, "until": until})
+	return err
+}
+
+func (db *Store) ResetLoginAttempts(ctx context.Context, key string) error {
+	_, err := db.Exec(ctx, "DELETE FROM login_attempts WHERE key = @key", pgx.NamedArgs{"key": key})
+	return err
+}
+
+const insertAudit = `INSERT INTO audit_log (actor_id, action, target, details, created_at)
+	VALUES (NULLIF(@actor_id, 0), @action, @target, @details, @created_at)`
+
+func auditArgs(rec AuditRecord) pgx.NamedArgs {
+	return pgx.NamedArgs{
+		"actor_id":   rec.ActorID,
+		"action":     rec.Action,
+		"target":     rec.Target,
+		"details":    rec.Details,
+		"created_at": rec.CreatedAt,
+	}
+}
+
+func (db *Store) AddAudit(ctx context.Context, rec AuditRecord) error {
+	_, err := db.Exec(ctx, insertAudit, auditArgs(rec))
+	return err
+}
+
+// audited runs the action and writes its audit record in one transaction, so failed actions are not audited
+func (db *Store) audited(ctx context.Context, rec AuditRecord, action func(tx pgx.Tx) error) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+	if err = action(tx); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, insertAudit, auditArgs(rec))
+	return err
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gophermart/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type UserEvent = model.UserEvent
+
+// userEventsChannel is a postgres NOTIFY channel, payload is JSON of UserEvent
+const userEventsChannel = "user_events"
+
+func (db *Store) CreateUserEventsTable(ctx context.Context) error {
+	_, err := db.Exec(ctx,
+		`CREATE TABLE IF NOT EXISTS user_events (
+			id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			user_id bigint NOT NULL,
+			type text NOT NULL,
+			data jsonb NOT NULL,
+			created_at timestamp with time zone NOT NULL)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx,
+		`CREATE INDEX IF NOT EXISTS user_events_user_idx ON user_events (user_id, id)`)
+	return err
+}
+
+// OnUserEvent sets function called for every user event after its transaction is committed
+func (db *Store) OnUserEvent(f func(UserEvent)) {
+	db.onEvent = f
+}
+
+func (db *Store) publish(events []UserEvent) {
+	if db.onEvent == nil {
+		return
+	}
+	for _, ev := range events {
+		db.onEvent(ev)
+	}
+}
+
+// addUserEvent saves event in transaction of the change and notifies listeners of all instances on commit
+func addUserEvent(ctx context.Context, tx pgx.Tx, userID int, typ string, data any) (UserEvent, error) {
+	ev := UserEvent{UserID: userID, Type: typ, CreatedAt: time.Now()}
+	var err error
+	ev.Data, err = json.Marshal(data)
+	if err != nil {
+		return ev, err
+	}
+	row := tx.QueryRow(ctx,
+		"INSERT INTO user_events (user_id, type, data, created_at) VALUES (@user_id, @type, @data, @created_at) RETURNING id",
+		pgx.NamedArgs{
+			"user_id":    ev.UserID,
+			"type":       ev.Type,
+			"data":       ev.Data,
+			"created_at": ev.CreatedAt,
+		})
+	if err = row.Scan(&ev.ID); err != nil {
+		return ev, err
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return ev, err
+	}
+	_, err = tx.Exec(ctx, "SELECT pg_notify(@channel, @payload)", pgx.NamedArgs{"channel": userEventsChannel, "payload": string(payload)})
+	return ev, err
+}
+
+// ListUserEvents returns events of user with id greater than afterID, from oldest
+func (db *Store) ListUserEvents(ctx context.Context, userID int, afterID int64, limit int) ([]UserEvent, error) {
+	events := []UserEvent{}
+	rows, err := db.Query(ctx,
+		`SELECT id, type, data, created_at FROM user_events
+		WHERE user_id = @user_id AND id > @after_id ORDER BY id LIMIT @limit`,
+		pgx.NamedArgs{"user_id": userID, "after_id": afterID, "limit": limit})
+	if err != nil {
+		return events, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		ev := UserEvent{UserID: userID}
+		err = rows.Scan(&ev.ID, &ev.Type, &ev.Data, &ev.CreatedAt)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// PruneUserEvents deletes at most limit events created before the time, from oldest
+func (db *Store) PruneUserEvents(ctx context.Context, before time.Time, limit int) (int64, error) {
+	tag, err := db.Exec(ctx,
+		`DELETE FROM user_events WHERE id IN (
+			SELECT id FROM user_events WHERE created_at < @before ORDER BY id LIMIT @limit)`,
+		pgx.NamedArgs{"before": before, "limit": limit})
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ListenUserEvents receives events of all instances with LISTEN until ctx is done.
+// Connection is reestablished after errors.
+func (db *Store) ListenUserEvents(ctx context.Context, f func(UserEvent)) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		err := db.listen(ctx, f)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Error(fmt.Sprintf("listen user events: %s, retry in %s", err, backoff))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+func (db *Store) listen(ctx context.Context, f func(UserEvent)) error {
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err = conn.Exec(ctx, "LISTEN "+userEventsChannel); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), "UNLISTEN "+userEventsChannel)
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var ev UserEvent
+		if err := json.Unmarshal([]byte(n.Payload), &ev); err != nil {
+			slog.Error(fmt.Sprintf("invalid user event: %s", err))
+			continue
+		}
+		f(ev)
+	}
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gophermart/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type MerchantKey = model.MerchantKey
+
+func (db *Store) CreateMerchantKeysTable(ctx context.Context) error {
+	_, err := db.Exec(ctx,
+		`CREATE TABLE IF NOT EXISTS merchant_keys (
+			id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			name text NOT NULL,
+			key_hash bytea NOT NULL UNIQUE,
+			scopes text[] NOT NULL,
+			created_by bigint NOT NULL,
+			created_at timestamp with time zone NOT NULL,
+			revoked_at timestamp with time zone)`)
+	return err
+}
+
+// AddMerchantKey stores new key, audit record is written in the same transaction
+func (db *Store) AddMerchantKey(ctx context.Context, key MerchantKey, rec AuditRecord) (int, error) {
+	err := db.audited(ctx, rec, func(tx pgx.Tx) error {
+		row := tx.QueryRow(ctx,
+			`INSERT INTO merchant_keys (name, key_hash, scopes, created_by, created_at)
+			VALUES (@name, @key_hash, @scopes, @created_by, @created_at) RETURNING id`,
+			pgx.NamedArgs{
+				"name":       key.Name,
+				"key_hash":   key.Hash,
+				"scopes":     key.Scopes,
+				"created_by": key.CreatedBy,
+				"created_at": key.CreatedAt,
+			})
+		return row.Scan(&key.ID)
+	})
+	return key.ID, err
+}
+
+// GetMerchantKey finds active key by its hash
+func (db *Store) GetMerchantKey(ctx context.Context, hash []byte) (*MerchantKey, error) {
+	key := &MerchantKey{Hash: hash}
+	row := db.QueryRow(ctx,
+		`SELECT id, name, scopes, created_by, created_at
+		FROM merchant_keys WHERE key_hash = @key_hash AND revoked_at IS NULL`,
+		pgx.NamedArgs{"key_hash": hash})
+	err := row.Scan(&key.ID, &key.Name, &key.Scopes, &key.CreatedBy, &key.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return key, model.ErrNoMerchantKey
+	}
+	return key, err
+}
+
+func (db *Store) ListMerchantKeys(ctx context.Context) ([]MerchantKey, error) {
+	keys := []MerchantKey{}
+	rows, err := db.Query(ctx, "SELECT id, name, scopes, created_by, created_at, revoked_at FROM merchant_keys ORDER BY id")
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		key := MerchantKey{}
+		err = rows.Scan(&key.ID, &key.Name, &key.Scopes, &key.CreatedBy, &key.CreatedAt, &key.RevokedAt)
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (db *Store) RevokeMerchantKey(ctx context.Context, id int, rec AuditRecord) error {
+	return db.audited(ctx, rec, func(tx pgx.Tx) error {
+		ct, err := tx.Exec(ctx,
+			"UPDATE merchant_keys SET revoked_at = @revoked_at WHERE id = @id AND revoked_at IS NULL",
+			pgx.NamedArgs{"id": id, "revoked_at": time.Now()})
+		if err != nil {
+			return err
+		}
+		if ct.RowsAffected() == 0 {
+			return model.ErrNoMerchantKey
+		}
+		return nil
+	})
+}
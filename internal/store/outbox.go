@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gophermart/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type OutboxMessage = model.OutboxMessage
+
+const (
+	// outboxLockClass is the high 16 bits of per-user transaction locks, see lockUserOutbox
+	outboxLockClass int64 = 0x0b0c
+	// outboxRelayLock is a session lock of the only relay
+	outboxRelayLock int64 = 0x0b0c_7e1a
+)
+
+func (db *Store) CreateOutboxTable(ctx context.Context) error {
+	_, err := db.Exec(ctx,
+		`CREATE TABLE IF NOT EXISTS outbox (
+			id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			user_id bigint NOT NULL,
+			type text NOT NULL,
+			payload jsonb NOT NULL,
+			created_at timestamp with time zone NOT NULL,
+			published_at timestamp with time zone)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx,
+		`CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox (id) WHERE published_at IS NULL`)
+	return err
+}
+
+// lockUserOutbox serializes transactions writing outbox of user until commit,
+// so ids of user messages grow in commit order. Must be taken before users row is locked.
+func lockUserOutbox(ctx context.Context, tx pgx.Tx, userID int) error {
+	// id пользователя - bigint, поэтому ключ один: класс в старших битах, id в младших 48
+	key := outboxLockClass<<48 | int64(userID)&(1<<48-1)
+	_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(@key)", pgx.NamedArgs{"key": key})
+	return err
+}
+
+// addOutbox saves message in transaction of the change, lockUserOutbox must be called before
+func addOutbox(ctx context.Context, tx pgx.Tx, userID int, typ string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		"INSERT INTO outbox (user_id, type, payload, created_at) VALUES (@user_id, @type, @payload, @created_at)",
+		pgx.NamedArgs{
+			"user_id":    userID,
+			"type":       typ,
+			"payload":    payload,
+			"created_at": time.Now(),
+		})
+	return err
+}
+
+// TryLockOutbox makes this instance the only relay until unlock is called. ok is false if other instance holds the lock.
+func (db *Store) TryLockOutbox(ctx context.Context) (unlock func(), ok bool, err error) {
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	err = conn.QueryRow(ctx, "SELECT pg_try_advisory_lock(@key)", pgx.NamedArgs{"key": outboxRelayLock}).Scan(&ok)
+	if err != nil || !ok {
+		conn.Release()
+		return nil, false, err
+	}
+	unlock = func() {
+		_, _ = conn.Exec(context.Background(), "SELECT pg_advisory_unlock(@key)", pgx.NamedArgs{"key": outboxRelayLock})
+		conn.Release()
+	}
+	return unlock, true, nil
+}
+
+// ListOutbox returns unpublished messages from oldest, skipping messages of skipUsers
+func (db *Store) ListOutbox(ctx context.Context, limit int, skipUsers []int) ([]OutboxMessage, error) {
+	msgs := []OutboxMessage{}
+	if skipUsers == nil {
+		skipUsers = []int{}
+	}
+	rows, err := db.Query(ctx,
+		`SELECT id, user_id, type, payload, created_at FROM outbox
+		WHERE published_at IS NULL AND user_id <> ALL(@skip_users) ORDER BY id LIMIT @limit`,
+		pgx.NamedArgs{"limit": limit, "skip_users": skipUsers})
+	if err != nil {
+		return msgs, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		msg := OutboxMessage{}
+		err = rows.Scan(&msg.ID, &msg.UserID, &msg.Type, &msg.Data, &msg.CreatedAt)
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, rows.Err()
+}
+
+func (db *Store) MarkOutboxPublished(ctx context.Context, ids []int64, at time.Time) error {
+	_, err := db.Exec(ctx,
+		"UPDATE outbox SET published_at = @published_at WHERE id = ANY(@ids)",
+		pgx.NamedArgs{"ids": ids, "published_at": at})
+	return err
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gophermart/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ListUnfinishedOrders returns orders which final status isn't known yet, oldest first.
+// Polling queue of every replica is rebuilt from them on startup, so orders queued by a crashed
+// or removed replica are polled too; ClaimOrderPolls makes only one replica poll each of them.
+func (db *Store) ListUnfinishedOrders(ctx context.Context) ([]model.QueuedOrder, error) {
+	orders := []model.QueuedOrder{}
+	rows, err := db.Query(ctx,
+		"SELECT id, user_id FROM orders WHERE status IN (@new, @registered, @processing) ORDER BY uploaded_at",
+		pgx.NamedArgs{
+			"new":        model.OrderStatusNew,
+			"registered": model.OrderStatusRegistered,
+			"processing": model.OrderStatusProcessing,
+		})
+	if err != nil {
+		return orders, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var o model.QueuedOrder
+		if err := rows.Scan(&o.OrderID, &o.UserID); err != nil {
+			return orders, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+// ClaimOrderPolls leases unfinished orders to owner. Order is claimed if its lease is expired or already
+// belongs to owner, so the owner extends it on every poll. Orders leased to other replicas are returned
+// separately, ids missing in both have final status. Lease is measured by database clock.
+func (db *Store) ClaimOrderPolls(ctx context.Context, orderIDs []int, owner string, lease time.Duration) (claimed, leased []int, err error) {
+	rows, err := db.Query(ctx,
+		`WITH claimed AS (
+			UPDATE orders SET poll_owner = @owner, poll_lease_until = now() + @lease
+			WHERE id = ANY(@ids) AND status IN (@new, @registered, @processing)
+				AND (poll_lease_until IS NULL OR poll_lease_until < now() OR poll_owner = @owner)
+			RETURNING id)
+		SELECT id, true FROM claimed
+		UNION ALL
+		SELECT id, false FROM orders
+		WHERE id = ANY(@ids) AND status IN (@new, @registered, @processing) AND id NOT IN (SELECT id FROM claimed)`,
+		pgx.NamedArgs{
+			"ids":        orderIDs,
+			"owner":      owner,
+			"lease":      lease,
+			"new":        model.OrderStatusNew,
+			"registered": model.OrderStatusRegistered,
+			"processing": model.OrderStatusProcessing,
+		})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var own bool
+		if err := rows.Scan(&id, &own); err != nil {
+			return nil, nil, err
+		}
+		if own {
+			claimed = append(claimed, id)
+		} else {
+			leased = append(leased, id)
+		}
+	}
+	return claimed, leased, rows.Err()
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// schemaVersion must be increased with every change of tables created in NewStore
+const schemaVersion = 4
+
+func (db *Store) CreateSchemaVersionTable(ctx context.Context) error {
+	_, err := db.Exec(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_version (
+			version integer PRIMARY KEY,
+			applied_at timestamptz NOT NULL
+		)`)
+	return err
+}
+
+// setSchemaVersion records that tables of current version exist
+func (db *Store) setSchemaVersion(ctx context.Context) error {
+	_, err := db.Exec(ctx, "INSERT INTO schema_version (version, applied_at) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		schemaVersion, time.Now())
+	return err
+}
+
+// CheckSchema fails when database is migrated by another version of service,
+// e.g. old replica is still running after rollout of a newer one
+func (db *Store) CheckSchema(ctx context.Context) error {
+	var version *int
+	if err := db.QueryRow(ctx, "SELECT max(version) FROM schema_version").Scan(&version); err != nil {
+		return err
+	}
+	if version == nil {
+		return fmt.Errorf("schema version is not recorded")
+	}
+	if *version != schemaVersion {
+		return fmt.Errorf("schema version is %d, service expects %d", *version, schemaVersion)
+	}
+	return nil
+}
@@ -3,16 +3,42 @@ package store
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"time"
 
+	"gophermart/internal/metrics"
 	"gophermart/internal/model"
+	"gophermart/internal/tracing"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var (
+	pointsAccrued   = metrics.NewCounterVec("gophermart_points_accrued_total", "Points credited for processed orders.")
+	pointsWithdrawn = metrics.NewCounterVec("gophermart_points_withdrawn_total", "Points spent by users.")
+	// счётчик не может убывать, поэтому списания администратором считаются отдельно от начислений
+	pointsAdjusted = metrics.NewCounterVec("gophermart_points_adjusted_total",
+		"Points credited or debited by administrators.", "direction")
+)
+
+func countAdjustment(amount float64) {
+	if amount < 0 {
+		pointsAdjusted.Add(-amount, "debit")
+		return
+	}
+	pointsAdjusted.Add(amount, "credit")
+}
+
+// uniqueViolation is postgres error code unique_violation
+const uniqueViolation = "23505"
+
 type Store struct {
 	*pgxpool.Pool
+	onEvent func(UserEvent)
 }
 
 type User = model.User
@@ -22,12 +48,32 @@ type Balance = model.Balance
 type Payment = model.Payment
 type PaymentFact = model.PaymentFact
 
-func NewStore(ctx context.Context, connString string) (*Store, error) {
-	dbpool, err := pgxpool.New(ctx, connString)
+// Option configures connection pool
+type Option func(cfg *pgxpool.Config)
+
+// WithMaxConns limits size of connection pool, zero keeps pgx default
+func WithMaxConns(n int32) Option {
+	return func(cfg *pgxpool.Config) {
+		if n > 0 {
+			cfg.MaxConns = n
+		}
+	}
+}
+
+func NewStore(ctx context.Context, connString string, opts ...Option) (*Store, error) {
+	poolCfg, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return &Store{}, err
+	}
+	for _, opt := range opts {
+		opt(poolCfg)
+	}
+	poolCfg.ConnConfig.Tracer = queryTracer{}
+	dbpool, err := pgxpool.NewWithConfig(ctx, poolCfg)
 	if err != nil {
 		return &Store{}, err
 	}
-	st := Store{dbpool}
+	st := Store{Pool: dbpool}
 	err = st.CreateUsersTable(ctx)
 	if err != nil {
 		return &Store{}, err
@@ -40,6 +86,46 @@ func NewStore(ctx context.Context, connString string) (*Store, error) {
 	if err != nil {
 		return &Store{}, err
 	}
+	err = st.CreateOrderHistoryTable(ctx)
+	if err != nil {
+		return &Store{}, err
+	}
+	err = st.CreateLoginAttemptsTable(ctx)
+	if err != nil {
+		return &Store{}, err
+	}
+	err = st.CreateAuditTable(ctx)
+	if err != nil {
+		return &Store{}, err
+	}
+	err = st.CreateAdjustmentsTable(ctx)
+	if err != nil {
+		return &Store{}, err
+	}
+	err = st.CreateMerchantKeysTable(ctx)
+	if err != nil {
+		return &Store{}, err
+	}
+	err = st.CreateUserEventsTable(ctx)
+	if err != nil {
+		return &Store{}, err
+	}
+	err = st.CreateWebhooksTable(ctx)
+	if err != nil {
+		return &Store{}, err
+	}
+	err = st.CreateOutboxTable(ctx)
+	if err != nil {
+		return &Store{}, err
+	}
+	err = st.CreateSchemaVersionTable(ctx)
+	if err != nil {
+		return &Store{}, err
+	}
+	err = st.setSchemaVersion(ctx)
+	if err != nil {
+		return &Store{}, err
+	}
 
 	return &st, nil
 }
@@ -55,14 +141,40 @@ func (db *Store) CreateUsersTable(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	_, err = db.Exec(ctx,
+		`ALTER TABLE users
+			ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT 'user',
+			ADD COLUMN IF NOT EXISTS blocked boolean NOT NULL DEFAULT false`)
+	if err != nil {
+		return err
+	}
 	_, err = db.Exec(ctx,
 		`CREATE INDEX IF NOT EXISTS users_login_idx ON users (login)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx,
+		`CREATE UNIQUE INDEX IF NOT EXISTS users_login_lower_idx ON users (lower(login))`)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		// в старых данных есть логины, отличающиеся только регистром, уникальность проверяется в AddUser
+		slog.Warn("case-insensitive login index is not created: duplicate logins exist")
+		return nil
+	}
 	return err
 }
 
 func (db *Store) AddUser(ctx context.Context, u User) (int, error) {
-	row := db.QueryRow(ctx, "INSERT INTO users (login, password, sum, writeoff) VALUES ($1, $2, $3, $4) RETURNING id", u.Login, u.Hash, 0, 0)
+	row := db.QueryRow(ctx,
+		`INSERT INTO users (login, password, sum, writeoff)
+		SELECT $1, $2, $3, $4
+		WHERE NOT EXISTS (SELECT 1 FROM users WHERE lower(login) = lower($1))
+		RETURNING id`, u.Login, u.Hash, 0, 0)
 	err := row.Scan(&u.ID)
+	var pgErr *pgconn.PgError
+	if errors.Is(err, pgx.ErrNoRows) || (errors.As(err, &pgErr) && pgErr.Code == uniqueViolation) {
+		return 0, model.ErrLoginTaken
+	}
 	if err != nil {
 		return 0, err
 	}
@@ -71,8 +183,11 @@ func (db *Store) AddUser(ctx context.Context, u User) (int, error) {
 
 func (db *Store) GetUser(ctx context.Context, login string) (*User, error) {
 	u := &User{Login: login}
-	row := db.QueryRow(ctx, "SELECT id, password FROM users WHERE login = $1", u.Login)
-	err := row.Scan(&u.ID, &u.Hash)
+	row := db.QueryRow(ctx, "SELECT id, password, role, blocked FROM users WHERE login = $1", u.Login)
+	err := row.Scan(&u.ID, &u.Hash, &u.Role, &u.Blocked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return u, model.ErrUserNotFound
+	}
 	if err != nil {
 		return u, err
 	}
@@ -88,6 +203,29 @@ func (db *Store) CreateOrdersTable(ctx context.Context) error {
 			uploaded_at timestamp with time zone NOT NULL,
 			processed_at timestamp with time zone,
 			accrual double precision)`) // accrual - сумма начисленных баллов за заказ, получаем из внешней системы
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx,
+		`CREATE INDEX IF NOT EXISTS orders_user_uploaded_idx ON orders (user_id, uploaded_at DESC, id DESC)`)
+	if err != nil {
+		return err
+	}
+	// ключ мерчанта, загрузившего заказ
+	_, err = db.Exec(ctx, `ALTER TABLE orders ADD COLUMN IF NOT EXISTS merchant_key_id bigint`)
+	if err != nil {
+		return err
+	}
+	// W3C traceparent загрузки, связывает трассу загрузки с начислением
+	_, err = db.Exec(ctx, `ALTER TABLE orders ADD COLUMN IF NOT EXISTS traceparent text`)
+	if err != nil {
+		return err
+	}
+	// экземпляр, который опрашивает заказ в accrual, и срок его аренды, см. ClaimOrderPolls
+	_, err = db.Exec(ctx,
+		`ALTER TABLE orders
+			ADD COLUMN IF NOT EXISTS poll_owner text,
+			ADD COLUMN IF NOT EXISTS poll_lease_until timestamp with time zone`)
 	return err
 }
 
@@ -99,39 +237,65 @@ func (db *Store) CreatePaymentsTable(ctx context.Context) error {
 			order_id bigint NOT NULL UNIQUE,
 			processed_at timestamp with time zone,			
 			sum double precision)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx,
+		`CREATE INDEX IF NOT EXISTS payments_user_processed_idx ON payments (user_id, processed_at DESC, order_id DESC)`)
 	return err
 }
 
-func (db *Store) AddOrder(ctx context.Context, orderID int, userID int) (model.OrderStatus, error) {
+// AddOrder saves new order of user, merchantKeyID is set when merchant uploads it and 0 otherwise.
+// Merchant is recorded only for new order, so its events are queued for merchant webhooks from the start.
+func (db *Store) AddOrder(ctx context.Context, orderID int, userID int, merchantKeyID int) (_ model.OrderStatus, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return -1, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+	if err = lockUserOutbox(ctx, tx, userID); err != nil {
+		return -1, err
+	}
 	t := time.Now()
-	ct, err := db.Exec(ctx,
+	ct, err := tx.Exec(ctx,
 		`INSERT INTO orders (
 			id,
 			status,
 			user_id,
-			uploaded_at
+			uploaded_at,
+			traceparent,
+			merchant_key_id
 		) VALUES (
 			@id,
 			@status,
 			@user_id,
-			@uploaded_at
+			@uploaded_at,
+			NULLIF(@traceparent, ''),
+			NULLIF(@merchant_key_id, 0)
 		) ON CONFLICT (id) DO NOTHING`,
 		pgx.NamedArgs{
-			"id":          orderID,
-			"user_id":     userID,
-			"uploaded_at": t,
-			"status":      model.OrderStatusNew,
+			"id":              orderID,
+			"user_id":         userID,
+			"uploaded_at":     t,
+			"status":          model.OrderStatusNew,
+			"traceparent":     tracing.Traceparent(ctx),
+			"merchant_key_id": merchantKeyID,
 		})
 	if err != nil {
 		return -1, err
 	}
 	if ct.RowsAffected() == 0 {
-		row := db.QueryRow(ctx, "SELECT status, user_id, uploaded_at FROM orders WHERE id = @id", pgx.NamedArgs{"id": orderID})
+		row := tx.QueryRow(ctx, "SELECT status, user_id, uploaded_at FROM orders WHERE id = @id", pgx.NamedArgs{"id": orderID})
 		var uploadedAt time.Time
 		var status OrderStatus
 		var userIDFromOrder int
-		err = row.Scan(&status, &userIDFromOrder, &uploadedAt)
-		if err != nil {
+		if err = row.Scan(&status, &userIDFromOrder, &uploadedAt); err != nil {
 			return -1, err
 		}
 		if userID == userIDFromOrder {
@@ -139,28 +303,222 @@ func (db *Store) AddOrder(ctx context.Context, orderID int, userID int) (model.O
 		}
 		return -1, model.ErrOrderExists
 	}
-	return model.OrderStatusNew, nil
+	err = addOutbox(ctx, tx, userID, model.OutboxOrderUploaded,
+		model.OrderUploadedData{Number: orderID, Status: model.OrderStatusNew, UploadedAt: t})
+	return model.OrderStatusNew, err
 }
 
-func (db *Store) UpdateOrderInfo(ctx context.Context, info model.AccrualResp) error {
+// AddOrders saves new orders of user in one statement. Result is set for every order
+// the same way as AddOrder does.
+func (db *Store) AddOrders(ctx context.Context, orderIDs []int, userID int) (_ []model.OrderUpload, err error) {
+	uploads := make([]model.OrderUpload, 0, len(orderIDs))
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return uploads, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+	if err = lockUserOutbox(ctx, tx, userID); err != nil {
+		return uploads, err
+	}
+	statusNew, err := model.OrderStatusNew.MarshalText()
+	if err != nil {
+		return uploads, err
+	}
+	// основной запрос видит таблицу orders до вставки, поэтому join находит только ранее загруженные заказы
+	rows, err := tx.Query(ctx,
+		`WITH input AS (
+			SELECT DISTINCT unnest(@ids::bigint[]) AS id
+		), inserted AS (
+			INSERT INTO orders (id, status, user_id, uploaded_at, traceparent)
+			SELECT id, @status, @user_id, @uploaded_at, NULLIF(@traceparent, '') FROM input
+			ON CONFLICT (id) DO NOTHING
+			RETURNING id
+		), outboxed AS (
+			INSERT INTO outbox (user_id, type, payload, created_at)
+			SELECT @user_id, @outbox_type,
+				jsonb_build_object('number', id::text, 'status', @status_name::text, 'uploaded_at', @uploaded_at::timestamptz),
+				@uploaded_at
+			FROM inserted ORDER BY id
+		)
+		SELECT input.id, inserted.id IS NOT NULL, orders.user_id, orders.status
+		FROM input
+		LEFT JOIN inserted ON inserted.id = input.id
+		LEFT JOIN orders ON orders.id = input.id`,
+		pgx.NamedArgs{
+			"ids":         orderIDs,
+			"status":      model.OrderStatusNew,
+			"status_name": string(statusNew),
+			"user_id":     userID,
+			"uploaded_at": time.Now(),
+			"outbox_type": model.OutboxOrderUploaded,
+			"traceparent": tracing.Traceparent(ctx),
+		})
+	if err != nil {
+		return uploads, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			upload   model.OrderUpload
+			inserted bool
+			ownerID  *int
+			status   *OrderStatus
+		)
+		err = rows.Scan(&upload.ID, &inserted, &ownerID, &status)
+		if err != nil {
+			return uploads, err
+		}
+		switch {
+		case inserted:
+			upload.Result = model.UploadAccepted
+			upload.Status = model.OrderStatusNew
+		case ownerID != nil && *ownerID == userID:
+			upload.Result = model.UploadAlreadyUploaded
+			upload.Status = *status
+		default:
+			upload.Result = model.UploadOwnedByOther
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, rows.Err()
+}
+
+// UpdateOrderInfo saves order status received from accrual system. Status changes are written
+// to order history, accrual is credited to user balance once, when order becomes PROCESSED.
+func (db *Store) UpdateOrderInfo(ctx context.Context, info model.AccrualResp) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	var events []UserEvent
+	var accrued float64
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+		if err = tx.Commit(ctx); err == nil {
+			db.publish(events)
+			pointsAccrued.Add(accrued)
+		}
+	}()
 	u := &User{}
-	row := db.QueryRow(ctx, "UPDATE orders SET status = @status, processed_at = @processed_at, accrual = @accrual WHERE id = @id RETURNING user_id",
+	var prevStatus OrderStatus
+	var traceparent *string
+	row := tx.QueryRow(ctx, "SELECT user_id, status, traceparent FROM orders WHERE id = @id FOR UPDATE", pgx.NamedArgs{"id": info.Order})
+	err = row.Scan(&u.ID, &prevStatus, &traceparent)
+	if err != nil {
+		return err
+	}
+	if traceparent != nil {
+		// опрос идёт в своей трассе, ссылка ведёт к запросу, загрузившему заказ
+		trace.SpanFromContext(ctx).AddLink(trace.Link{SpanContext: tracing.SpanContext(*traceparent)})
+	}
+	now := time.Now()
+	_, err = tx.Exec(ctx, "UPDATE orders SET status = @status, processed_at = @processed_at, accrual = @accrual WHERE id = @id",
 		pgx.NamedArgs{
 			"id":           info.Order,
 			"status":       info.Status,
-			"processed_at": time.Now(),
+			"processed_at": now,
 			"accrual":      info.Accrual,
 		})
-	err := row.Scan(&u.ID)
 	if err != nil {
 		return err
 	}
+	if prevStatus == info.Status {
+		return nil
+	}
+	if err = lockUserOutbox(ctx, tx, u.ID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "INSERT INTO order_status_history (order_id, status, accrual, seen_at) VALUES (@order_id, @status, @accrual, @seen_at)",
+		pgx.NamedArgs{
+			"order_id": info.Order,
+			"status":   info.Status,
+			"accrual":  info.Accrual,
+			"seen_at":  now,
+		})
+	if err != nil {
+		return err
+	}
+	evType := model.EventOrderStatus
 	if info.Status == model.OrderStatusProcessed {
-		_, err = db.Exec(ctx, "UPDATE users SET sum = sum + @sum WHERE id = @id", pgx.NamedArgs{"sum": info.Accrual, "id": u.ID})
+		evType = model.EventOrderCredited
 	}
+	evData := model.OrderEventData{Number: info.Order, Status: info.Status, Accrual: info.Accrual}
+	ev, err := addUserEvent(ctx, tx, u.ID, evType, evData)
+	if err != nil {
+		return err
+	}
+	// вебхуки получают смену статуса из outbox
+	if err = addOutbox(ctx, tx, u.ID, model.OutboxOrderStatus, evData); err != nil {
+		return err
+	}
+	events = append(events, ev)
+	if info.Status == model.OrderStatusProcessed {
+		var balance Balance
+		row = tx.QueryRow(ctx, "UPDATE users SET sum = sum + @sum WHERE id = @id RETURNING sum, writeoff", pgx.NamedArgs{"sum": info.Accrual, "id": u.ID})
+		if err = row.Scan(&balance.Sum, &balance.WriteOff); err != nil {
+			return err
+		}
+		ev, err = addUserEvent(ctx, tx, u.ID, model.EventBalanceChanged, balance)
+		if err != nil {
+			return err
+		}
+		events = append(events, ev)
+		credit := model.CreditData{Number: info.Order, Balance: balance}
+		if info.Accrual != nil {
+			credit.Sum = *info.Accrual
+			accrued = credit.Sum
+		}
+		err = addOutbox(ctx, tx, u.ID, model.OutboxBalanceCredited, credit)
+	}
+	return err
+}
+
+func (db *Store) CreateOrderHistoryTable(ctx context.Context) error {
+	_, err := db.Exec(ctx,
+		`CREATE TABLE IF NOT EXISTS order_status_history (
+			id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			order_id bigint NOT NULL,
+			status integer NOT NULL,
+			accrual double precision,
+			seen_at timestamp with time zone NOT NULL)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx,
+		`CREATE INDEX IF NOT EXISTS order_status_history_order_idx ON order_status_history (order_id, seen_at)`)
 	return err
 }
 
+// GetOrderHistory returns status changes of order from oldest to newest
+func (db *Store) GetOrderHistory(ctx context.Context, orderID int) ([]model.OrderStatusEvent, error) {
+	history := []model.OrderStatusEvent{}
+	rows, err := db.Query(ctx,
+		"SELECT status, accrual, seen_at FROM order_status_history WHERE order_id = @order_id ORDER BY seen_at, id",
+		pgx.NamedArgs{"order_id": orderID})
+	if err != nil {
+		return history, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		event := model.OrderStatusEvent{}
+		err = rows.Scan(&event.Status, &event.Accrual, &event.SeenAt)
+		if err != nil {
+			return history, err
+		}
+		history = append(history, event)
+	}
+	return history, rows.Err()
+}
+
 func (db *Store) ListOrders(ctx context.Context, userID int) ([]Order, error) {
 	orders := []Order{}
 	rows, err := db.Query(ctx, `SELECT
@@ -188,6 +546,51 @@ func (db *Store) ListOrders(ctx context.Context, userID int) ([]Order, error) {
 	return orders, nil
 }
 
+// ListOrdersPage returns orders sorted from newest, at most filter.Limit of them
+func (db *Store) ListOrdersPage(ctx context.Context, userID int, filter model.OrderFilter) ([]Order, error) {
+	orders := []Order{}
+	query := `SELECT id, status, uploaded_at, accrual FROM orders WHERE user_id = @user_id`
+	args := pgx.NamedArgs{"user_id": userID, "limit": filter.Limit}
+	if len(filter.Statuses) > 0 {
+		statuses := make([]int32, 0, len(filter.Statuses))
+		for _, s := range filter.Statuses {
+			statuses = append(statuses, int32(s))
+		}
+		query += ` AND status = ANY(@statuses)`
+		args["statuses"] = statuses
+	}
+	if !filter.From.IsZero() {
+		query += ` AND uploaded_at >= @from`
+		args["from"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		query += ` AND uploaded_at < @to`
+		args["to"] = filter.To
+	}
+	if filter.After != nil {
+		query += ` AND (uploaded_at, id) < (@cursor_at, @cursor_id)`
+		args["cursor_at"] = filter.After.At
+		args["cursor_id"] = filter.After.ID
+	}
+	query += ` ORDER BY uploaded_at DESC, id DESC LIMIT @limit`
+
+	rows, err := db.Query(ctx, query, args)
+	if err != nil {
+		return orders, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		order := Order{}
+		err = rows.Scan(&order.ID, &order.Status, &order.UploadedAt, &order.Accrual)
+		if err != nil {
+			return orders, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
 func (db *Store) GetBalance(ctx context.Context, userID int) (*Balance, error) {
 	balance := Balance{}
 	row := db.QueryRow(ctx, "SELECT sum, writeoff FROM users WHERE id = @id", pgx.NamedArgs{"id": userID})
@@ -198,18 +601,25 @@ func (db *Store) GetBalance(ctx context.Context, userID int) (*Balance, error) {
 	return &balance, nil
 }
 
-func (db *Store) SpendBonus(ctx context.Context, userID int, payment Payment) error {
+func (db *Store) SpendBonus(ctx context.Context, userID int, payment Payment) (err error) {
 	tx, err := db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	var events []UserEvent
 	defer func() {
 		if err != nil {
 			_ = tx.Rollback(ctx)
 			return
 		}
-		err = tx.Commit(ctx)
+		if err = tx.Commit(ctx); err == nil {
+			db.publish(events)
+			pointsWithdrawn.Add(payment.Sum)
+		}
 	}()
+	if err = lockUserOutbox(ctx, tx, userID); err != nil {
+		return err
+	}
 	row := tx.QueryRow(ctx, "SELECT sum FROM users WHERE id = @id FOR UPDATE", pgx.NamedArgs{"id": userID})
 	var sum float64
 	err = row.Scan(&sum)
@@ -219,17 +629,32 @@ func (db *Store) SpendBonus(ctx context.Context, userID int, payment Payment) er
 	if sum < payment.Sum {
 		return model.ErrNotEnough
 	}
+	fact := PaymentFact{Payment: payment, ProcessedAt: time.Now()}
 	_, err = tx.Exec(ctx, "INSERT INTO payments (user_id, order_id, processed_at, sum) VALUES (@user_id, @order_id, @processed_at, @sum)",
 		pgx.NamedArgs{
 			"user_id":      userID,
 			"order_id":     payment.OrderID,
-			"processed_at": time.Now(),
+			"processed_at": fact.ProcessedAt,
 			"sum":          payment.Sum,
 		})
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec(ctx, "UPDATE users SET sum = sum - @sum, writeoff = writeoff + @sum WHERE id = @id", pgx.NamedArgs{"sum": payment.Sum, "id": userID})
+	ev, err := addUserEvent(ctx, tx, userID, model.EventWithdrawal, fact)
+	if err != nil {
+		return err
+	}
+	events = append(events, ev)
+	if err = addOutbox(ctx, tx, userID, model.OutboxWithdrawal, fact); err != nil {
+		return err
+	}
+	var balance Balance
+	row = tx.QueryRow(ctx, "UPDATE users SET sum = sum - @sum, writeoff = writeoff + @sum WHERE id = @id RETURNING sum, writeoff", pgx.NamedArgs{"sum": payment.Sum, "id": userID})
+	if err = row.Scan(&balance.Sum, &balance.WriteOff); err != nil {
+		return err
+	}
+	ev, err = addUserEvent(ctx, tx, userID, model.EventBalanceChanged, balance)
+	events = append(events, ev)
 	return err
 }
 
@@ -250,3 +675,53 @@ func (db *Store) SpentBonusList(ctx context.Context, userID int) ([]PaymentFact,
 	}
 	return payments, nil
 }
+
+// paymentsRange adds conditions on processed_at to query
+func paymentsRange(query string, args pgx.NamedArgs, from, to time.Time) string {
+	if !from.IsZero() {
+		query += ` AND processed_at >= @from`
+		args["from"] = from
+	}
+	if !to.IsZero() {
+		query += ` AND processed_at < @to`
+		args["to"] = to
+	}
+	return query
+}
+
+// SpentBonusPage returns withdrawals sorted from newest, at most filter.Limit of them
+func (db *Store) SpentBonusPage(ctx context.Context, userID int, filter model.PaymentFilter) ([]PaymentFact, error) {
+	payments := []PaymentFact{}
+	args := pgx.NamedArgs{"user_id": userID, "limit": filter.Limit}
+	query := paymentsRange(`SELECT order_id, sum, processed_at FROM payments WHERE user_id = @user_id`, args, filter.From, filter.To)
+	if filter.After != nil {
+		query += ` AND (processed_at, order_id) < (@cursor_at, @cursor_id)`
+		args["cursor_at"] = filter.After.At
+		args["cursor_id"] = filter.After.ID
+	}
+	query += ` ORDER BY processed_at DESC, order_id DESC LIMIT @limit`
+
+	rows, err := db.Query(ctx, query, args)
+	if err != nil {
+		return payments, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		payment := PaymentFact{}
+		err = rows.Scan(&payment.OrderID, &payment.Sum, &payment.ProcessedAt)
+		if err != nil {
+			return payments, err
+		}
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+// SpentBonusSummary counts withdrawals and their total in the range
+func (db *Store) SpentBonusSummary(ctx context.Context, userID int, from, to time.Time) (model.WithdrawalSummary, error) {
+	summary := model.WithdrawalSummary{}
+	args := pgx.NamedArgs{"user_id": userID}
+	query := paymentsRange(`SELECT count(*), COALESCE(sum(sum), 0) FROM payments WHERE user_id = @user_id`, args, from, to)
+	err := db.QueryRow(ctx, query, args).Scan(&summary.Count, &summary.Total)
+	return summary, err
+}
@@ -0,0 +1,260 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gophermart/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Webhook = model.Webhook
+type WebhookOwner = model.WebhookOwner
+type WebhookDelivery = model.WebhookDelivery
+
+func (db *Store) CreateWebhooksTable(ctx context.Context) error {
+	_, err := db.Exec(ctx,
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			user_id bigint,
+			merchant_key_id bigint,
+			url text NOT NULL,
+			secret text NOT NULL,
+			events text[] NOT NULL,
+			created_at timestamp with time zone NOT NULL,
+			deleted_at timestamp with time zone)`)
+	if err != nil {
+		return err
+	}
+	// журнал доставки и очередь повторов; события приходят из outbox, см. QueueWebhookEvent
+	_, err = db.Exec(ctx,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			webhook_id bigint NOT NULL,
+			event text NOT NULL,
+			payload jsonb NOT NULL,
+			status text NOT NULL,
+			attempts integer NOT NULL DEFAULT 0,
+			last_code integer,
+			last_error text,
+			next_attempt_at timestamp with time zone,
+			delivered_at timestamp with time zone,
+			created_at timestamp with time zone NOT NULL)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx,
+		`CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending'`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx,
+		`CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, id DESC)`)
+	if err != nil {
+		return err
+	}
+	// сообщение outbox, из которого создана доставка; релей может опубликовать его повторно
+	_, err = db.Exec(ctx, `ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS outbox_id bigint`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx,
+		`CREATE UNIQUE INDEX IF NOT EXISTS webhook_deliveries_outbox_idx ON webhook_deliveries (webhook_id, outbox_id)`)
+	return err
+}
+
+// ownerArgs matches webhooks of owner with COALESCE(user_id, 0) = @user_id AND COALESCE(merchant_key_id, 0) = @merchant_key_id
+func ownerArgs(owner WebhookOwner, args pgx.NamedArgs) pgx.NamedArgs {
+	args["user_id"] = owner.UserID
+	args["merchant_key_id"] = owner.MerchantKeyID
+	return args
+}
+
+func nullID(id int) *int {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+func (db *Store) AddWebhook(ctx context.Context, wh Webhook) (int, error) {
+	row := db.QueryRow(ctx,
+		`INSERT INTO webhooks (user_id, merchant_key_id, url, secret, events, created_at)
+		VALUES (@user_id, @merchant_key_id, @url, @secret, @events, @created_at) RETURNING id`,
+		pgx.NamedArgs{
+			"user_id":         nullID(wh.Owner.UserID),
+			"merchant_key_id": nullID(wh.Owner.MerchantKeyID),
+			"url":             wh.URL,
+			"secret":          wh.Secret,
+			"events":          wh.Events,
+			"created_at":      wh.CreatedAt,
+		})
+	err := row.Scan(&wh.ID)
+	return wh.ID, err
+}
+
+func (db *Store) ListWebhooks(ctx context.Context, owner WebhookOwner) ([]Webhook, error) {
+	hooks := []Webhook{}
+	rows, err := db.Query(ctx,
+		`SELECT id, url, events, created_at FROM webhooks
+		WHERE COALESCE(user_id, 0) = @user_id AND COALESCE(merchant_key_id, 0) = @merchant_key_id AND deleted_at IS NULL
+		ORDER BY id`,
+		ownerArgs(owner, pgx.NamedArgs{}))
+	if err != nil {
+		return hooks, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		wh := Webhook{Owner: owner}
+		err = rows.Scan(&wh.ID, &wh.URL, &wh.Events, &wh.CreatedAt)
+		if err != nil {
+			return hooks, err
+		}
+		hooks = append(hooks, wh)
+	}
+	return hooks, rows.Err()
+}
+
+// DeleteWebhook stops new deliveries, log of the webhook is kept
+func (db *Store) DeleteWebhook(ctx context.Context, owner WebhookOwner, id int) error {
+	ct, err := db.Exec(ctx,
+		`UPDATE webhooks SET deleted_at = @deleted_at
+		WHERE id = @id AND COALESCE(user_id, 0) = @user_id AND COALESCE(merchant_key_id, 0) = @merchant_key_id AND deleted_at IS NULL`,
+		ownerArgs(owner, pgx.NamedArgs{"id": id, "deleted_at": time.Now()}))
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return model.ErrNoWebhook
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns delivery log of webhook, newest first
+func (db *Store) ListWebhookDeliveries(ctx context.Context, owner WebhookOwner, webhookID int, limit int) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+	var exists bool
+	row := db.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM webhooks
+		WHERE id = @id AND COALESCE(user_id, 0) = @user_id AND COALESCE(merchant_key_id, 0) = @merchant_key_id)`,
+		ownerArgs(owner, pgx.NamedArgs{"id": webhookID}))
+	if err := row.Scan(&exists); err != nil {
+		return deliveries, err
+	}
+	if !exists {
+		return deliveries, model.ErrNoWebhook
+	}
+	rows, err := db.Query(ctx,
+		`SELECT id, event, payload, status, attempts, COALESCE(last_code, 0), COALESCE(last_error, ''), next_attempt_at, delivered_at, created_at
+		FROM webhook_deliveries WHERE webhook_id = @webhook_id ORDER BY id DESC LIMIT @limit`,
+		pgx.NamedArgs{"webhook_id": webhookID, "limit": limit})
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d := WebhookDelivery{WebhookID: webhookID}
+		err = rows.Scan(&d.ID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.LastCode, &d.LastError, &d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt)
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RedeliverWebhook queues delivery again regardless of its status, attempts are counted from scratch
+func (db *Store) RedeliverWebhook(ctx context.Context, owner WebhookOwner, webhookID int, deliveryID int64) error {
+	ct, err := db.Exec(ctx,
+		`UPDATE webhook_deliveries d SET status = @status, attempts = 0, next_attempt_at = @now
+		FROM webhooks w
+		WHERE d.id = @id AND d.webhook_id = @webhook_id AND w.id = d.webhook_id AND w.deleted_at IS NULL
+			AND COALESCE(w.user_id, 0) = @user_id AND COALESCE(w.merchant_key_id, 0) = @merchant_key_id`,
+		ownerArgs(owner, pgx.NamedArgs{
+			"id":         deliveryID,
+			"webhook_id": webhookID,
+			"status":     model.DeliveryPending,
+			"now":        time.Now(),
+		}))
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return model.ErrNoDelivery
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries takes due deliveries and postpones them by lease,
+// so other instances don't send them while this one is trying
+func (db *Store) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+	rows, err := db.Query(ctx,
+		`UPDATE webhook_deliveries d SET next_attempt_at = @lease_until
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = @status AND next_attempt_at <= @now
+			ORDER BY next_attempt_at LIMIT @limit FOR UPDATE SKIP LOCKED)
+		RETURNING d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.created_at, w.url, w.secret`,
+		pgx.NamedArgs{
+			"status":      model.DeliveryPending,
+			"now":         now,
+			"lease_until": now.Add(lease),
+			"limit":       limit,
+		})
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d := WebhookDelivery{}
+		err = rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.CreatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// SaveWebhookAttempt records result of delivery attempt
+func (db *Store) SaveWebhookAttempt(ctx context.Context, d WebhookDelivery) error {
+	_, err := db.Exec(ctx,
+		`UPDATE webhook_deliveries SET status = @status, attempts = @attempts, last_code = @last_code,
+			last_error = @last_error, next_attempt_at = @next_attempt_at, delivered_at = @delivered_at
+		WHERE id = @id`,
+		pgx.NamedArgs{
+			"id":              d.ID,
+			"status":          d.Status,
+			"attempts":        d.Attempts,
+			"last_code":       d.LastCode,
+			"last_error":      d.LastError,
+			"next_attempt_at": d.NextAttemptAt,
+			"delivered_at":    d.DeliveredAt,
+		})
+	return err
+}
+
+// QueueWebhookEvent creates deliveries of outbox message for webhooks of user and of merchant which uploaded the order.
+// Webhooks created after the message don't get it. Message published again by relay isn't queued twice.
+func (db *Store) QueueWebhookEvent(ctx context.Context, ev model.WebhookEvent) error {
+	_, err := db.Exec(ctx,
+		`INSERT INTO webhook_deliveries (webhook_id, outbox_id, event, payload, status, next_attempt_at, created_at)
+		SELECT id, @outbox_id, @event, @payload, @status, @now, @now FROM webhooks
+		WHERE deleted_at IS NULL AND @event = ANY(events) AND created_at <= @created_at
+			AND (user_id = @user_id OR merchant_key_id = (SELECT merchant_key_id FROM orders WHERE id = @order_id))
+		ON CONFLICT (webhook_id, outbox_id) DO NOTHING`,
+		pgx.NamedArgs{
+			"outbox_id":  ev.OutboxID,
+			"event":      ev.Event,
+			"payload":    ev.Payload,
+			"status":     model.DeliveryPending,
+			"now":        time.Now(),
+			"created_at": ev.CreatedAt,
+			"user_id":    ev.UserID,
+			"order_id":   ev.OrderID,
+		})
+	return err
+}
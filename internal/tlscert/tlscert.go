@@ -0,0 +1,97 @@
+// Package tlscert serves TLS certificate which is reloaded when its files change on disk
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Reloader keeps the last valid key pair, a broken or half-written update doesn't break serving
+type Reloader struct {
+	certFile, keyFile string
+	cert              atomic.Pointer[tls.Certificate]
+	// время изменения файлов загруженной пары
+	certMod, keyMod time.Time
+}
+
+// New loads key pair, it fails if files are missing or don't match
+func New(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate is for tls.Config
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// Reload loads key pair if any of files is changed since the last load
+func (r *Reloader) Reload() (bool, error) {
+	certMod, err := modTime(r.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyMod, err := modTime(r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	if certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod) {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("load TLS key pair: %w", err)
+	}
+	r.cert.Store(&cert)
+	r.certMod, r.keyMod = certMod, keyMod
+	return true, nil
+}
+
+// Watch checks files every interval until ctx is done. Polling of modification time
+// also notices Kubernetes secret updates, which replace symlinks rather than files.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				slog.Error(fmt.Sprintf("TLS certificate is not reloaded, previous one is served: %s", err))
+				continue
+			}
+			if reloaded {
+				slog.Info("TLS certificate reloaded", slog.String("cert_file", r.certFile))
+			}
+		}
+	}
+}
+
+func modTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// MinVersion parses minimum TLS version of config
+func MinVersion(s string) (uint16, error) {
+	switch s {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q, expected 1.2 or 1.3", s)
+}
@@ -0,0 +1,99 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeKeyPair writes self-signed certificate with given serial number
+func writeKeyPair(t *testing.T, certFile, keyFile string, serial int64, mod time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), mod)
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), mod)
+}
+
+func writeFile(t *testing.T, path string, data []byte, mod time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func serial(t *testing.T, r *Reloader) int64 {
+	t.Helper()
+	cert, _ := r.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	start := time.Now().Add(-time.Minute)
+	writeKeyPair(t, certFile, keyFile, 1, start)
+
+	r, err := New(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := r.Reload(); reloaded || err != nil {
+		t.Errorf("unchanged files: got reloaded %v, error %v", reloaded, err)
+	}
+
+	// сертификат обновлён, а ключ ещё нет: продолжает отдаваться прежняя пара
+	writeFile(t, certFile, []byte("-----BEGIN CERTIFICATE-----\ntruncated"), start.Add(time.Second))
+	if _, err := r.Reload(); err == nil {
+		t.Error("broken key pair is loaded")
+	}
+	if got := serial(t, r); got != 1 {
+		t.Errorf("got certificate %d after failed reload, want 1", got)
+	}
+
+	writeKeyPair(t, certFile, keyFile, 2, start.Add(2*time.Second))
+	if reloaded, err := r.Reload(); !reloaded || err != nil {
+		t.Fatalf("changed files: got reloaded %v, error %v", reloaded, err)
+	}
+	if got := serial(t, r); got != 2 {
+		t.Errorf("got certificate %d, want 2", got)
+	}
+}
+
+func TestNew_MissingFiles(t *testing.T) {
+	if _, err := New("missing.crt", "missing.key"); err == nil {
+		t.Error("missing key pair is accepted")
+	}
+}
@@ -0,0 +1,85 @@
+// Package tracing configures OpenTelemetry spans export and W3C trace context propagation
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "gophermart"
+
+// AttrOrderID is set on every span related to order, it joins upload and credit in trace search
+const AttrOrderID = attribute.Key("gophermart.order.id")
+
+// Tracer returns tracer of registered provider, spans are dropped until Setup is called
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Setup registers provider exporting spans as JSON lines to stdout or file.
+// Empty exporter disables tracing, but traceparent is still propagated.
+// Returned function flushes pending spans, it must be called on shutdown.
+func Setup(exporter, file string, sampleRatio float64) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var w io.Writer
+	var closer io.Closer
+	switch exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		w = os.Stdout
+	case "file":
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		w, closer = f, f
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", exporter)
+	}
+	exp, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	if err != nil {
+		return nil, err
+	}
+	res := resource.NewSchemaless(attribute.String("service.name", tracerName))
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			if cerr := closer.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Traceparent formats span context of ctx as W3C traceparent, it's empty without sampled span
+func Traceparent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier["traceparent"]
+}
+
+// SpanContext parses W3C traceparent, e.g. saved with order
+func SpanContext(traceparent string) trace.SpanContext {
+	carrier := propagation.MapCarrier{"traceparent": traceparent}
+	ctx := propagation.TraceContext{}.Extract(context.Background(), carrier)
+	return trace.SpanContextFromContext(ctx)
+}
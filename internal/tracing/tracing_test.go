@@ -0,0 +1,25 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestTraceparent(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "upload")
+	defer span.End()
+
+	tp := Traceparent(ctx)
+	if tp == "" {
+		t.Fatal("traceparent of sampled span must not be empty")
+	}
+	if got := SpanContext(tp); !got.Equal(span.SpanContext().WithRemote(true)) {
+		t.Errorf("got span context %+v, want %+v", got, span.SpanContext())
+	}
+	if Traceparent(context.Background()) != "" {
+		t.Error("traceparent without span must be empty")
+	}
+}
@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned for endpoints in internal networks, webhooks must not reach them
+var ErrBlockedAddress = errors.New("address is not allowed")
+
+var errUnexpectedStatus = errors.New("unexpected status")
+
+// allowedAddr reports whether webhook may connect to ip:
+// loopback, private, link-local, unspecified and multicast addresses are denied
+func allowedAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
+
+// CheckURL validates endpoint on registration. Host names are resolved only on delivery,
+// the dialer checks the connected address, so DNS rebinding doesn't help either.
+func CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be absolute http or https url")
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("url host: %w", ErrBlockedAddress)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !allowedAddr(ip) {
+		return fmt.Errorf("url host: %w", ErrBlockedAddress)
+	}
+	return nil
+}
+
+// denyInternal is net.Dialer.Control, it runs for every resolved address before connecting
+func denyInternal(_, address string, _ syscall.RawConn) error {
+	addr, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !allowedAddr(addr.Addr()) {
+		return fmt.Errorf("dial %s: %w", addr.Addr(), ErrBlockedAddress)
+	}
+	return nil
+}
+
+// newClient doesn't follow redirects and doesn't use proxy from environment,
+// control nil allows any address and is used in tests only
+func newClient(timeout time.Duration, control func(network, address string, c syscall.RawConn) error) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// errorClass is shown to webhook owner instead of error text, which may describe internal network
+func errorClass(err error) string {
+	var (
+		netErr  net.Error
+		dnsErr  *net.DNSError
+		certErr *tls.CertificateVerificationError
+		hostErr x509.HostnameError
+		authErr x509.UnknownAuthorityError
+		recErr  tls.RecordHeaderError
+	)
+	switch {
+	case errors.Is(err, ErrBlockedAddress):
+		return "blocked_address"
+	case errors.Is(err, errUnexpectedStatus):
+		return "unexpected_status"
+	case errors.As(err, &dnsErr):
+		return "dns_error"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case errors.As(err, &certErr), errors.As(err, &hostErr), errors.As(err, &authErr), errors.As(err, &recErr):
+		return "tls_error"
+	}
+	return "connection_error"
+}
@@ -0,0 +1,166 @@
+// Package webhook delivers queued events to partner endpoints
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gophermart/internal/model"
+)
+
+// Headers of webhook request
+const (
+	HeaderSignature = "X-Gophermart-Signature"
+	HeaderTimestamp = "X-Gophermart-Timestamp"
+	HeaderEvent     = "X-Gophermart-Event"
+	HeaderDelivery  = "X-Gophermart-Delivery"
+)
+
+type Delivery = model.WebhookDelivery
+
+// Store is an outbox of webhook deliveries
+type Store interface {
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Delivery, error)
+	SaveWebhookAttempt(ctx context.Context, d Delivery) error
+}
+
+type Policy struct {
+	MaxAttempts int           // after that delivery is marked failed, it may be redelivered manually
+	BaseDelay   time.Duration // delay after first failed attempt, doubled after each next one
+	MaxDelay    time.Duration
+	Timeout     time.Duration // of one request
+	BatchSize   int
+}
+
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	policy Policy
+	now    func() time.Time
+}
+
+func NewDispatcher(store Store, policy Policy) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		client: newClient(policy.Timeout, denyInternal),
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+// Sign returns signature of body sent at ts: hex of HMAC-SHA256 of "<ts>.<body>" prefixed with "sha256="
+func Sign(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", ts)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run sends due deliveries every interval until ctx is done
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.dispatch(ctx)
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	// аренда с запасом покрывает все запросы пачки
+	lease := 2 * d.policy.Timeout
+	deliveries, err := d.store.ClaimWebhookDeliveries(ctx, d.now(), lease, d.policy.BatchSize)
+	if err != nil {
+		slog.Error(fmt.Sprintf("claim webhook deliveries: %s", err))
+		return
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(deliveries))
+	for _, dl := range deliveries {
+		go func(dl Delivery) {
+			defer wg.Done()
+			d.deliver(ctx, dl)
+		}(dl)
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, dl Delivery) {
+	dl.Attempts++
+	code, err := d.send(ctx, dl)
+	dl.LastCode = code
+	now := d.now()
+	if err == nil {
+		dl.Status = model.DeliveryDelivered
+		dl.LastError = ""
+		dl.NextAttemptAt = nil
+		dl.DeliveredAt = &now
+	} else {
+		// владельцу виден только класс ошибки, подробности - в логе сервиса
+		dl.LastError = errorClass(err)
+		if dl.Attempts >= d.policy.MaxAttempts {
+			dl.Status = model.DeliveryFailed
+			dl.NextAttemptAt = nil
+		} else {
+			next := now.Add(d.backoff(dl.Attempts))
+			dl.NextAttemptAt = &next
+		}
+		slog.Warn("webhook delivery failed",
+			slog.Int64("delivery_id", dl.ID),
+			slog.Int("attempts", dl.Attempts),
+			slog.String("error", err.Error()),
+		)
+	}
+	if err := d.store.SaveWebhookAttempt(ctx, dl); err != nil {
+		slog.Error(fmt.Sprintf("save webhook attempt: %s", err))
+	}
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.policy.BaseDelay
+	for i := 1; i < attempts && delay < d.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.policy.MaxDelay {
+		delay = d.policy.MaxDelay
+	}
+	return delay
+}
+
+// send returns status code of response, any code except 2xx is an error
+func (d *Dispatcher) send(ctx context.Context, dl Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		return 0, err
+	}
+	ts := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, dl.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(dl.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(dl.Secret, ts, dl.Payload))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("%w %s", errUnexpectedStatus, resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"gophermart/internal/model"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestDispatcher_deliver(t *testing.T) {
+	now := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	policy := Policy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Timeout: time.Second, BatchSize: 10}
+	payload := []byte(`{"event":"order.processed","data":{"number":"7992723465","status":"PROCESSED","accrual":500}}`)
+
+	tests := []struct {
+		name       string
+		code       int
+		attempts   int
+		wantStatus model.DeliveryStatus
+		wantNext   time.Duration
+	}{
+		{name: "delivered", code: http.StatusNoContent, wantStatus: model.DeliveryDelivered},
+		{name: "retry_after_first_failure", code: http.StatusInternalServerError, wantStatus: model.DeliveryPending, wantNext: time.Minute},
+		{name: "backoff_doubles", code: http.StatusBadGateway, attempts: 1, wantStatus: model.DeliveryPending, wantNext: 2 * time.Minute},
+		{name: "attempts_exhausted", code: http.StatusNotFound, attempts: 2, wantStatus: model.DeliveryFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				ts, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+				if ts != now.Unix() {
+					t.Errorf("got timestamp %d, want %d", ts, now.Unix())
+				}
+				if got := r.Header.Get(HeaderSignature); got != Sign("whsec", ts, body) {
+					t.Errorf("invalid signature %s", got)
+				}
+				if r.Header.Get(HeaderEvent) != model.WebhookOrderProcessed || r.Header.Get(HeaderDelivery) != "42" {
+					t.Errorf("unexpected headers %v", r.Header)
+				}
+				w.WriteHeader(tt.code)
+			}))
+			defer server.Close()
+
+			ctrl := gomock.NewController(t)
+			m := NewMockStore(ctrl)
+			d := NewDispatcher(m, policy)
+			d.now = func() time.Time { return now }
+			// тестовый сервер слушает loopback
+			d.client = newClient(policy.Timeout, nil)
+
+			dl := Delivery{
+				ID:       42,
+				Event:    model.WebhookOrderProcessed,
+				Payload:  payload,
+				Status:   model.DeliveryPending,
+				Attempts: tt.attempts,
+				URL:      server.URL,
+				Secret:   "whsec",
+			}
+			m.EXPECT().SaveWebhookAttempt(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, got Delivery) error {
+					if got.Status != tt.wantStatus || got.Attempts != tt.attempts+1 || got.LastCode != tt.code {
+						t.Errorf("got delivery %+v", got)
+					}
+					var next time.Duration
+					if got.NextAttemptAt != nil {
+						next = got.NextAttemptAt.Sub(now)
+					}
+					if next != tt.wantNext {
+						t.Errorf("got next attempt in %s, want %s", next, tt.wantNext)
+					}
+					return nil
+				})
+			d.deliver(context.Background(), dl)
+		})
+	}
+}
+
+func TestDispatcher_InternalEndpoints(t *testing.T) {
+	policy := Policy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Timeout: time.Second, BatchSize: 10}
+	var reached bool
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer internal.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(internal.URL, http.StatusFound))
+	defer redirect.Close()
+
+	tests := []struct {
+		name      string
+		url       string
+		allowAll  bool
+		wantCode  int
+		wantError string
+	}{
+		{name: "loopback_is_blocked", url: internal.URL, wantError: "blocked_address"},
+		{name: "redirect_is_not_followed", url: redirect.URL, allowAll: true, wantCode: http.StatusFound, wantError: "unexpected_status"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = false
+			ctrl := gomock.NewController(t)
+			m := NewMockStore(ctrl)
+			d := NewDispatcher(m, policy)
+			if tt.allowAll {
+				d.client = newClient(policy.Timeout, nil)
+			}
+			m.EXPECT().SaveWebhookAttempt(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, got Delivery) error {
+					if got.LastCode != tt.wantCode || got.LastError != tt.wantError {
+						t.Errorf("got code %d and error %q", got.LastCode, got.LastError)
+					}
+					return nil
+				})
+			d.deliver(context.Background(), Delivery{ID: 1, URL: tt.url, Secret: "whsec", Payload: []byte("{}")})
+			if reached {
+				t.Error("internal endpoint is reached")
+			}
+		})
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	for _, raw := range []string{
+		"http://127.0.0.1:8080/hooks",
+		"http://localhost/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"https://10.0.0.5/hooks",
+		"http://192.168.1.1/",
+		"http://[::1]/hooks",
+		"http://[::ffff:127.0.0.1]/hooks",
+		"http://0.0.0.0/",
+		"ftp://partner.example/hooks",
+	} {
+		if err := CheckURL(raw); err == nil {
+			t.Errorf("%s is accepted", raw)
+		}
+	}
+	for _, raw := range []string{"https://partner.example/hooks", "http://203.0.113.10:8443/hooks"} {
+		if err := CheckURL(raw); err != nil {
+			t.Errorf("%s: %v", raw, err)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"
+	if got := Sign("secret", 1700000000, []byte("{}")); got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"gophermart/internal/model"
+)
+
+// EventStore queues deliveries for webhooks subscribed to event
+type EventStore interface {
+	QueueWebhookEvent(ctx context.Context, ev model.WebhookEvent) error
+}
+
+// Fanout is an outbox publisher which turns messages into webhook deliveries, Dispatcher sends them.
+// Queueing is idempotent, so it may share relay with other publishers.
+type Fanout struct {
+	store EventStore
+}
+
+func NewFanout(store EventStore) *Fanout {
+	return &Fanout{store: store}
+}
+
+func (f *Fanout) Publish(ctx context.Context, msg model.OutboxMessage) error {
+	event, orderID, ok := webhookEvent(msg)
+	if !ok {
+		return nil
+	}
+	payload, err := json.Marshal(model.WebhookPayload{Event: event, CreatedAt: msg.CreatedAt, Data: msg.Data})
+	if err != nil {
+		return err
+	}
+	return f.store.QueueWebhookEvent(ctx, model.WebhookEvent{
+		OutboxID:  msg.ID,
+		UserID:    msg.UserID,
+		OrderID:   orderID,
+		Event:     event,
+		Payload:   payload,
+		CreatedAt: msg.CreatedAt,
+	})
+}
+
+// webhookEvent maps outbox message to webhook event, ok is false for messages without webhook
+func webhookEvent(msg model.OutboxMessage) (event string, orderID int, ok bool) {
+	switch msg.Type {
+	case model.OutboxOrderStatus:
+		var data model.OrderEventData
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			// повтор не исправит сообщение, а задержал бы остальные сообщения пользователя
+			slog.Error("malformed outbox message is not sent to webhooks",
+				slog.Int64("message_id", msg.ID), slog.String("error", err.Error()))
+			return "", 0, false
+		}
+		switch data.Status {
+		case model.OrderStatusProcessed:
+			return model.WebhookOrderProcessed, data.Number, true
+		case model.OrderStatusInvalid:
+			return model.WebhookOrderInvalid, data.Number, true
+		}
+	case model.OutboxWithdrawal:
+		return model.WebhookWithdrawalCreated, 0, true
+	}
+	return "", 0, false
+}
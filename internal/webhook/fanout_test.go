@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gophermart/internal/model"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestFanout_Publish(t *testing.T) {
+	created := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		msgType   string
+		data      string
+		wantEvent string
+		wantOrder int
+	}{
+		{
+			name:      "order_processed",
+			msgType:   model.OutboxOrderStatus,
+			data:      `{"number":"7992723465","status":"PROCESSED","accrual":500}`,
+			wantEvent: model.WebhookOrderProcessed,
+			wantOrder: 7992723465,
+		},
+		{
+			name:      "order_invalid",
+			msgType:   model.OutboxOrderStatus,
+			data:      `{"number":"7992723465","status":"INVALID"}`,
+			wantEvent: model.WebhookOrderInvalid,
+			wantOrder: 7992723465,
+		},
+		{
+			name:      "withdrawal",
+			msgType:   model.OutboxWithdrawal,
+			data:      `{"order":"2377225624","sum":751}`,
+			wantEvent: model.WebhookWithdrawalCreated,
+		},
+		{name: "status_without_webhook", msgType: model.OutboxOrderStatus, data: `{"number":"7992723465","status":"PROCESSING"}`},
+		{name: "uploaded", msgType: model.OutboxOrderUploaded, data: `{"number":"7992723465","status":"NEW"}`},
+		{name: "malformed", msgType: model.OutboxOrderStatus, data: `[]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			m := NewMockEventStore(ctrl)
+			msg := model.OutboxMessage{ID: 42, UserID: 7, Type: tt.msgType, Data: []byte(tt.data), CreatedAt: created}
+			if tt.wantEvent != "" {
+				m.EXPECT().QueueWebhookEvent(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, ev model.WebhookEvent) error {
+						if ev.OutboxID != 42 || ev.UserID != 7 || ev.Event != tt.wantEvent || ev.OrderID != tt.wantOrder {
+							t.Errorf("got event %+v", ev)
+						}
+						var p model.WebhookPayload
+						if err := json.Unmarshal(ev.Payload, &p); err != nil {
+							t.Fatal(err)
+						}
+						if p.Event != tt.wantEvent || !p.CreatedAt.Equal(created) || string(p.Data) != tt.data {
+							t.Errorf("got payload %s", ev.Payload)
+						}
+						return nil
+					})
+			}
+			if err := NewFanout(m).Publish(context.Background(), msg); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}